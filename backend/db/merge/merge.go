@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// maxBatchWrites is the most writes Firestore allows in one batch.
+const maxBatchWrites = 500
+
+// write is a planned change to one document.
+type write struct {
+	ref    *firestore.DocumentRef
+	data   map[string]interface{}
+	merge  bool
+	delete bool
+	desc   string
+}
+
+// plan holds the writes needed to merge or split trucks, so that they can
+// be printed for a dry run before any are made.
+type plan struct {
+	writes []write
+}
+
+func (p *plan) set(ref *firestore.DocumentRef, data map[string]interface{}, desc string) {
+	p.writes = append(p.writes, write{ref: ref, data: data, desc: desc})
+}
+
+func (p *plan) merge(ref *firestore.DocumentRef, data map[string]interface{}, desc string) {
+	p.writes = append(p.writes, write{ref: ref, data: data, merge: true, desc: desc})
+}
+
+func (p *plan) delete(ref *firestore.DocumentRef, desc string) {
+	p.writes = append(p.writes, write{ref: ref, delete: true, desc: desc})
+}
+
+// print prints the planned writes.
+func (p *plan) print() {
+	for _, w := range p.writes {
+		fmt.Println(w.desc)
+	}
+	fmt.Printf("%d writes planned\n", len(p.writes))
+}
+
+// commit makes the planned writes, in as many batches as needed.
+func (p *plan) commit(ctx context.Context, client *firestore.Client) error {
+	for start := 0; start < len(p.writes); start += maxBatchWrites {
+		end := start + maxBatchWrites
+		if end > len(p.writes) {
+			end = len(p.writes)
+		}
+		batch := client.Batch()
+		for _, w := range p.writes[start:end] {
+			switch {
+			case w.delete:
+				batch.Delete(w.ref)
+			case w.merge:
+				batch.Set(w.ref, w.data, firestore.MergeAll)
+			default:
+				batch.Set(w.ref, w.data)
+			}
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return fmt.Errorf("Committed %d of %d writes: %v", start, len(p.writes), err)
+		}
+		log.Printf("Committed %d of %d writes", end, len(p.writes))
+	}
+	return nil
+}
+
+// getTruck returns the data for a truck, or an error if it does not exist.
+func getTruck(ctx context.Context, id string, client *firestore.Client) (map[string]interface{}, error) {
+	doc, err := client.Collection("trucks").Doc(id).Get(ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("Truck %s does not exist", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Data(), nil
+}
+
+// truckNames returns the truck names which refer to a truck.
+func truckNames(ctx context.Context, id string, client *firestore.Client) ([]string, error) {
+	docs, err := client.Collection("truckNames").Where("id", "==", id).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, doc := range docs {
+		names = append(names, doc.Ref.ID)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// mergeTruckData returns the fields of truck `from` which `into` lacks or
+// has empty, e.g. a Twitter handle, leaving out the rating aggregates which
+// are recomputed.
+func mergeTruckData(into, from map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{})
+	for k, v := range from {
+		if k == "avgRating" || k == "numRatings" {
+			continue
+		}
+		if existing, ok := into[k]; !ok || existing == "" || existing == nil {
+			if v != "" && v != nil {
+				data[k] = v
+			}
+		}
+	}
+	return data
+}
+
+// entryWindows returns the time windows of a truck's entry at a stop in a
+// schedule document. Older documents have a single window, or none, in
+// place of the list of windows.
+func entryWindows(entry interface{}) []map[string]interface{} {
+	doc, _ := entry.(map[string]interface{})
+	list, ok := doc["windows"].([]interface{})
+	if !ok {
+		list = []interface{}{doc}
+	}
+	var windows []map[string]interface{}
+	for _, w := range list {
+		window, _ := w.(map[string]interface{})
+		if window == nil {
+			window = map[string]interface{}{}
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// mergeEntries returns a truck's entry at a stop with the time windows of
+// two entries, stored as the loader stores them: a truck which is there all
+// day has one window with no times, and otherwise the windows are in order
+// of start and end time, with a window in both entries kept once.
+func mergeEntries(a, b interface{}) map[string]interface{} {
+	var windows []map[string]interface{}
+	seen := make(map[string]bool)
+	for _, w := range append(entryWindows(a), entryWindows(b)...) {
+		start, _ := w["start"].(string)
+		end, _ := w["end"].(string)
+		if start == "" {
+			return map[string]interface{}{"windows": []interface{}{w}}
+		}
+		if !seen[start+" "+end] {
+			seen[start+" "+end] = true
+			windows = append(windows, w)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		si, _ := windows[i]["start"].(string)
+		sj, _ := windows[j]["start"].(string)
+		if si != sj {
+			return si < sj
+		}
+		ei, _ := windows[i]["end"].(string)
+		ej, _ := windows[j]["end"].(string)
+		return ei < ej
+	})
+	list := make([]interface{}, len(windows))
+	for i, w := range windows {
+		list[i] = w
+	}
+	return map[string]interface{}{"windows": list}
+}
+
+// mergeScheduleDoc returns a schedule document with truck `from` replaced
+// by truck `into` at every stop, and whether anything changed. If both were
+// at a stop, `into` has the time windows of both.
+func mergeScheduleDoc(doc map[string]interface{}, into, from string) (map[string]interface{}, bool) {
+	changed := false
+	result := make(map[string]interface{})
+	for stop, v := range doc {
+		trucks, ok := v.(map[string]interface{})
+		if !ok {
+			result[stop] = v
+			continue
+		}
+		newTrucks := make(map[string]interface{})
+		for id, entry := range trucks {
+			if id == from {
+				changed = true
+				if other, ok := trucks[into]; ok {
+					entry = mergeEntries(other, entry)
+				}
+				id = into
+			} else if id == into {
+				if _, ok := trucks[from]; ok {
+					continue
+				}
+			}
+			newTrucks[id] = entry
+		}
+		result[stop] = newTrucks
+	}
+	return result, changed
+}
+
+// mergeChangeLog replaces truck `from` by truck `into` in the assignments
+// added and removed in a scheduleChanges document, and returns the document
+// and whether anything changed.
+func mergeChangeLog(doc map[string]interface{}, into, from string) (map[string]interface{}, bool) {
+	changed := false
+	days, _ := doc["days"].(map[string]interface{})
+	for _, day := range days {
+		stops, _ := day.(map[string]interface{})
+		for _, diff := range stops {
+			lists, _ := diff.(map[string]interface{})
+			for _, list := range lists {
+				assignments, _ := list.([]interface{})
+				for _, a := range assignments {
+					if a, ok := a.(map[string]interface{}); ok && a["truck"] == from {
+						a["truck"] = into
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return doc, changed
+}
+
+// The stages of a finished load in its manifest, as in the loaddb package.
+const (
+	loadDone       = "done"
+	loadRolledBack = "rolledBack"
+)
+
+// unfinishedLoads returns the files whose last load did not finish. Rolling
+// one back restores the schedules from before it, which may refer to a
+// truck which has since been merged, so a merge waits until they are
+// rolled back, e.g. with load_db -rollback.
+func unfinishedLoads(ctx context.Context, client *firestore.Client) ([]string, error) {
+	docs, err := client.Collection("loadManifests").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, doc := range docs {
+		stage, _ := doc.Data()["stage"].(string)
+		if stage != loadDone && stage != loadRolledBack {
+			files = append(files, doc.Ref.ID)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// rating is a user's rating of a truck.
+type rating struct {
+	Rating   int64     `firestore:"rating"`
+	Datetime time.Time `firestore:"datetime"`
+}
+
+// getRatings returns the ratings of a truck, keyed by user ID.
+func getRatings(ctx context.Context, id string, client *firestore.Client) (map[string]rating, error) {
+	docs, err := client.Collection("ratings").Doc(id).Collection("ratings").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	ratings := make(map[string]rating)
+	for _, doc := range docs {
+		var r rating
+		if err := doc.DataTo(&r); err != nil {
+			return nil, err
+		}
+		ratings[doc.Ref.ID] = r
+	}
+	return ratings, nil
+}
+
+// mergeRatings returns the ratings of `from` which should move to `into`:
+// those by users who have not rated `into`, or rated it less recently.
+func mergeRatings(into, from map[string]rating) map[string]rating {
+	moved := make(map[string]rating)
+	for user, r := range from {
+		if existing, ok := into[user]; ok && !existing.Datetime.Before(r.Datetime) {
+			continue
+		}
+		moved[user] = r
+	}
+	return moved
+}
+
+// ratingDocs returns the rating documents to write for `into` for the
+// ratings of `from` which are moved, keyed by user ID, and the ratings of
+// `into` once they are. Each document records in mergedFrom the truck it
+// came from, which tells the average rating function to ignore the write,
+// since the average is recomputed by the merge.
+func ratingDocs(from string, intoRatings, fromRatings map[string]rating) (map[string]map[string]interface{}, map[string]rating) {
+	docs := make(map[string]map[string]interface{})
+	merged := make(map[string]rating)
+	for user, r := range intoRatings {
+		merged[user] = r
+	}
+	for user, r := range mergeRatings(intoRatings, fromRatings) {
+		docs[user] = map[string]interface{}{"rating": r.Rating, "datetime": r.Datetime, "mergedFrom": from}
+		merged[user] = r
+	}
+	return docs, merged
+}
+
+// aggregate returns the average and number of ratings.
+func aggregate(ratings map[string]rating) (float64, int) {
+	if len(ratings) == 0 {
+		return 0, 0
+	}
+	var sum int64
+	for _, r := range ratings {
+		sum += r.Rating
+	}
+	return float64(sum) / float64(len(ratings)), len(ratings)
+}
+
+// planMerge returns the writes which merge truck `from` into truck `into`:
+// its names are pointed at `into`, it is replaced by `into` in all
+// schedules and schedule change logs, its ratings are moved to `into` and the average rating of
+// `into` is recomputed, and then it is deleted.
+func planMerge(ctx context.Context, into, from string, client *firestore.Client) (*plan, error) {
+	if into == from {
+		return nil, errors.New("Cannot merge a truck into itself")
+	}
+	intoData, err := getTruck(ctx, into, client)
+	if err != nil {
+		return nil, err
+	}
+	fromData, err := getTruck(ctx, from, client)
+	if err != nil {
+		return nil, err
+	}
+	unfinished, err := unfinishedLoads(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if len(unfinished) > 0 {
+		return nil, fmt.Errorf("Loads of %s did not finish; roll them back before merging", strings.Join(unfinished, ", "))
+	}
+	p := &plan{}
+
+	names, err := truckNames(ctx, from, client)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		p.set(client.Collection("truckNames").Doc(name), map[string]interface{}{"id": into},
+			fmt.Sprintf("truckNames/%s: id %s -> %s", name, from, into))
+	}
+	pending, err := client.Collection("pendingTruckNames").Where("candidateId", "==", from).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range pending {
+		p.merge(doc.Ref, map[string]interface{}{"candidateId": into},
+			fmt.Sprintf("pendingTruckNames/%s: candidateId %s -> %s", doc.Ref.ID, from, into))
+	}
+
+	schedules, err := client.Collection("schedules").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range schedules {
+		if merged, changed := mergeScheduleDoc(doc.Data(), into, from); changed {
+			p.set(doc.Ref, merged, fmt.Sprintf("schedules/%s: truck %s -> %s", doc.Ref.ID, from, into))
+		}
+	}
+
+	changes, err := client.Collection("scheduleChanges").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range changes {
+		if merged, changed := mergeChangeLog(doc.Data(), into, from); changed {
+			p.set(doc.Ref, merged, fmt.Sprintf("scheduleChanges/%s: truck %s -> %s", doc.Ref.ID, from, into))
+		}
+	}
+
+	intoRatings, err := getRatings(ctx, into, client)
+	if err != nil {
+		return nil, err
+	}
+	fromRatings, err := getRatings(ctx, from, client)
+	if err != nil {
+		return nil, err
+	}
+	moved, merged := ratingDocs(from, intoRatings, fromRatings)
+	var users []string
+	for user := range fromRatings {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	for _, user := range users {
+		if doc, ok := moved[user]; ok {
+			p.set(client.Collection("ratings").Doc(into).Collection("ratings").Doc(user), doc,
+				fmt.Sprintf("ratings/%s/ratings/%s: moved to ratings/%s/ratings/%s", from, user, into, user))
+		}
+		p.delete(client.Collection("ratings").Doc(from).Collection("ratings").Doc(user),
+			fmt.Sprintf("ratings/%s/ratings/%s: deleted", from, user))
+	}
+
+	data := mergeTruckData(intoData, fromData)
+	avg, num := aggregate(merged)
+	data["avgRating"] = avg
+	data["numRatings"] = num
+	p.merge(client.Collection("trucks").Doc(into), data,
+		fmt.Sprintf("trucks/%s: %v", into, data))
+	p.delete(client.Collection("trucks").Doc(from), fmt.Sprintf("trucks/%s: deleted", from))
+	return p, nil
+}
+
+// planSplit returns the writes which split the given names off truck
+// `from` into a new truck with the given display name. Schedules and
+// ratings stay with `from`, since there is no record of which name they
+// were for.
+func planSplit(ctx context.Context, from string, names []string, displayName string, client *firestore.Client) (*plan, error) {
+	if _, err := getTruck(ctx, from, client); err != nil {
+		return nil, err
+	}
+	if displayName == "" {
+		return nil, errors.New("A display name is needed for the new truck")
+	}
+	existing, err := truckNames(ctx, from, client)
+	if err != nil {
+		return nil, err
+	}
+	isName := make(map[string]bool)
+	for _, name := range existing {
+		isName[name] = true
+	}
+	p := &plan{}
+	newRef := client.Collection("trucks").NewDoc()
+	p.set(newRef, map[string]interface{}{"displayName": displayName},
+		fmt.Sprintf("trucks/%s: new truck %q", newRef.ID, displayName))
+	for _, name := range names {
+		if !isName[name] {
+			return nil, fmt.Errorf("%q is not a name of truck %s", name, from)
+		}
+		p.set(client.Collection("truckNames").Doc(name), map[string]interface{}{"id": newRef.ID},
+			fmt.Sprintf("truckNames/%s: id %s -> %s", name, from, newRef.ID))
+	}
+	return p, nil
+}
+
+func main() {
+	into := flag.String("into", "", "ID of the truck to merge into")
+	from := flag.String("from", "", "ID of the truck to merge, or to split names off")
+	split := flag.String("split", "", "comma-separated truck names to split off into a new truck")
+	displayName := flag.String("name", "", "display name of the new truck when splitting")
+	dryRun := flag.Bool("dry-run", false, "print the planned changes without making them")
+	flag.Parse()
+
+	ctx := context.Background()
+	project := os.Getenv("PROJECT")
+	client, err := firestore.NewClient(ctx, project)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	var p *plan
+	switch {
+	case *from != "" && *into != "":
+		p, err = planMerge(ctx, *into, *from, client)
+	case *from != "" && *split != "":
+		p, err = planSplit(ctx, *from, strings.Split(*split, ","), *displayName, client)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.print()
+	if *dryRun {
+		return
+	}
+	if err := p.commit(ctx, client); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeTruckData(t *testing.T) {
+	tests := []struct {
+		into, from, want map[string]interface{}
+	}{
+		{
+			into: map[string]interface{}{"displayName": "Foo Truck", "twitter": ""},
+			from: map[string]interface{}{"displayName": "Foo Truck LLC", "twitter": "@foo", "website": "foo.com"},
+			want: map[string]interface{}{"twitter": "@foo", "website": "foo.com"},
+		},
+		{
+			// Rating aggregates are recomputed, not copied.
+			into: map[string]interface{}{"displayName": "Foo Truck"},
+			from: map[string]interface{}{"avgRating": 4.5, "numRatings": 2, "menu": nil},
+			want: map[string]interface{}{},
+		},
+	}
+	for _, test := range tests {
+		if got := mergeTruckData(test.into, test.from); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("mergeTruckData(%v, %v) = %v, want %v", test.into, test.from, got, test.want)
+		}
+	}
+}
+
+func TestMergeScheduleDoc(t *testing.T) {
+	lunch := map[string]interface{}{"windows": []interface{}{
+		map[string]interface{}{"start": "11:00", "end": "14:00"},
+	}}
+	dinner := map[string]interface{}{"windows": []interface{}{
+		map[string]interface{}{"start": "17:00", "end": "21:00"},
+	}}
+	tests := []struct {
+		name    string
+		doc     map[string]interface{}
+		want    map[string]interface{}
+		changed bool
+	}{
+		{
+			name:    "from only",
+			doc:     map[string]interface{}{"A": map[string]interface{}{"from": lunch, "other": dinner}},
+			want:    map[string]interface{}{"A": map[string]interface{}{"into": lunch, "other": dinner}},
+			changed: true,
+		},
+		{
+			// When both trucks were at a stop, `into` has both windows.
+			name: "both at one stop",
+			doc:  map[string]interface{}{"A": map[string]interface{}{"from": dinner, "into": lunch}},
+			want: map[string]interface{}{"A": map[string]interface{}{"into": map[string]interface{}{"windows": []interface{}{
+				map[string]interface{}{"start": "11:00", "end": "14:00"},
+				map[string]interface{}{"start": "17:00", "end": "21:00"},
+			}}}},
+			changed: true,
+		},
+		{
+			name:    "both at one stop in the same window",
+			doc:     map[string]interface{}{"A": map[string]interface{}{"from": lunch, "into": lunch}},
+			want:    map[string]interface{}{"A": map[string]interface{}{"into": lunch}},
+			changed: true,
+		},
+		{
+			// Older documents have a single window, and a truck which is
+			// there all day has no times.
+			name: "both at one stop in old documents",
+			doc: map[string]interface{}{"A": map[string]interface{}{
+				"from": map[string]interface{}{"start": "17:00", "end": "21:00"},
+				"into": map[string]interface{}{},
+			}},
+			want: map[string]interface{}{"A": map[string]interface{}{"into": map[string]interface{}{"windows": []interface{}{
+				map[string]interface{}{},
+			}}}},
+			changed: true,
+		},
+		{
+			name: "both at different stops",
+			doc: map[string]interface{}{
+				"A": map[string]interface{}{"into": lunch},
+				"B": map[string]interface{}{"from": dinner},
+			},
+			want: map[string]interface{}{
+				"A": map[string]interface{}{"into": lunch},
+				"B": map[string]interface{}{"into": dinner},
+			},
+			changed: true,
+		},
+		{
+			name:    "neither",
+			doc:     map[string]interface{}{"A": map[string]interface{}{"other": lunch}},
+			want:    map[string]interface{}{"A": map[string]interface{}{"other": lunch}},
+			changed: false,
+		},
+	}
+	for _, test := range tests {
+		got, changed := mergeScheduleDoc(test.doc, "into", "from")
+		if !reflect.DeepEqual(got, test.want) || changed != test.changed {
+			t.Errorf("%s: mergeScheduleDoc = %v, %v, want %v, %v", test.name, got, changed, test.want, test.changed)
+		}
+	}
+}
+
+func TestMergeChangeLog(t *testing.T) {
+	doc := map[string]interface{}{
+		"file": "july.csv",
+		"days": map[string]interface{}{
+			"2019-07-01": map[string]interface{}{
+				"A": map[string]interface{}{
+					"added":   []interface{}{map[string]interface{}{"truck": "from", "start": "11:00"}},
+					"removed": []interface{}{map[string]interface{}{"truck": "other"}},
+				},
+			},
+		},
+	}
+	want := map[string]interface{}{
+		"file": "july.csv",
+		"days": map[string]interface{}{
+			"2019-07-01": map[string]interface{}{
+				"A": map[string]interface{}{
+					"added":   []interface{}{map[string]interface{}{"truck": "into", "start": "11:00"}},
+					"removed": []interface{}{map[string]interface{}{"truck": "other"}},
+				},
+			},
+		},
+	}
+	got, changed := mergeChangeLog(doc, "into", "from")
+	if !reflect.DeepEqual(got, want) || !changed {
+		t.Fatalf("mergeChangeLog = %v, %v, want %v, true", got, changed, want)
+	}
+	if _, changed := mergeChangeLog(got, "into", "from"); changed {
+		t.Fatal("mergeChangeLog changed a log without the truck")
+	}
+}
+
+func TestMergeRatings(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2019, 7, d, 0, 0, 0, 0, time.UTC)
+	}
+	into := map[string]rating{
+		"alice": {Rating: 5, Datetime: day(2)},
+		"bob":   {Rating: 2, Datetime: day(1)},
+	}
+	from := map[string]rating{
+		// Alice rated `into` more recently, so her rating of it is kept.
+		"alice": {Rating: 1, Datetime: day(1)},
+		// Bob rated `from` more recently, so it replaces his rating.
+		"bob":   {Rating: 4, Datetime: day(3)},
+		"carol": {Rating: 3, Datetime: day(1)},
+	}
+
+	docs, merged := ratingDocs("from", into, from)
+	wantDocs := map[string]map[string]interface{}{
+		"bob":   {"rating": int64(4), "datetime": day(3), "mergedFrom": "from"},
+		"carol": {"rating": int64(3), "datetime": day(1), "mergedFrom": "from"},
+	}
+	if !reflect.DeepEqual(docs, wantDocs) {
+		t.Fatalf("ratingDocs returned documents %v, want %v", docs, wantDocs)
+	}
+	wantMerged := map[string]rating{"alice": into["alice"], "bob": from["bob"], "carol": from["carol"]}
+	if !reflect.DeepEqual(merged, wantMerged) {
+		t.Fatalf("ratingDocs returned ratings %v, want %v", merged, wantMerged)
+	}
+	if into["bob"] != (rating{Rating: 2, Datetime: day(1)}) {
+		t.Fatal("ratingDocs changed the ratings of into")
+	}
+
+	tests := []struct {
+		ratings map[string]rating
+		avg     float64
+		num     int
+	}{
+		{nil, 0, 0},
+		{into, 3.5, 2},
+		{merged, 4, 3},
+	}
+	for _, test := range tests {
+		if avg, num := aggregate(test.ratings); avg != test.avg || num != test.num {
+			t.Errorf("aggregate(%v) = %v, %d, want %v, %d", test.ratings, avg, num, test.avg, test.num)
+		}
+	}
+}
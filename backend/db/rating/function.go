@@ -40,6 +40,11 @@ type Rating struct {
 	Rating struct {
 		IntegerValue string `json:"integerValue"`
 	} `json:"rating"`
+	// MergedFrom is set on ratings moved by the truck merge tool, which
+	// recomputes the average rating itself.
+	MergedFrom struct {
+		StringValue string `json:"stringValue"`
+	} `json:"mergedFrom"`
 }
 
 // Truck holds aggregate rating info for a truck.
@@ -76,7 +81,7 @@ func init() {
 
 // SetAvgRating updates a truck's average rating when a user enters a rating.
 func SetAvgRating(ctx context.Context, e FirestoreEvent) error {
-	if e.Value.Name == "" {
+	if e.Value.Name == "" || e.Value.Fields.MergedFrom.StringValue != "" {
 		return nil
 	}
 	path := strings.Split(e.Value.Name, "/documents/")[1]
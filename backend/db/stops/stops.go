@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// readCSV returns a slice of maps corresponding to the rows
+// in a CSV provided in `data`.
+func readCSV(data io.Reader) ([]map[string]string, error) {
+	r := csv.NewReader(data)
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	lines, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("No header row")
+	}
+	var records []map[string]string
+	fields := lines[0]
+	for _, line := range lines[1:] {
+		rec := make(map[string]string)
+		for i := 0; i < len(fields) && i < len(line); i++ {
+			rec[fields[i]] = line[i]
+		}
+		records = append(records, rec)
+
+	}
+	return records, nil
+}
+
+// Stop holds information about a vending location.
+type Stop struct {
+	DisplayName string
+	Names       []string
+	Latitude    float64
+	Longitude   float64
+	// HasLocation is whether Latitude and Longitude are set.
+	HasLocation bool
+}
+
+// stopAbbreviations maps abbreviations used in stop names to the words they
+// stand for. It must match the one used by the DC gov database load, which
+// is checked by TestStopAbbreviationsMatch in loaddb.
+var stopAbbreviations = map[string]string{
+	"sq":   "square",
+	"ave":  "avenue",
+	"av":   "avenue",
+	"pl":   "place",
+	"cir":  "circle",
+	"stn":  "station",
+	"sta":  "station",
+	"plz":  "plaza",
+	"blvd": "boulevard",
+}
+
+var stopWordRe = regexp.MustCompile(`[a-zA-Z0-9]+`)
+
+// keyName returns a string suitable for use as a Firestore document name,
+// with abbreviations expanded so that different spellings of the same stop
+// have the same key.
+func keyName(name string) string {
+	words := stopWordRe.FindAllString(strings.ToLower(name), -1)
+	for i, w := range words {
+		if full, ok := stopAbbreviations[w]; ok {
+			words[i] = full
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// readStops takes a CSV and returns an array of Stops.
+func readStops(file io.Reader) ([]Stop, error) {
+	recs, err := readCSV(file)
+	if err != nil {
+		return []Stop{}, err
+	}
+	stops := make(map[string]Stop)
+	var order []string
+	for _, rec := range recs {
+		name := rec["display_name"]
+		stop, ok := stops[name]
+		if !ok {
+			stop = Stop{
+				DisplayName: name,
+				Names:       []string{keyName(name)},
+			}
+			order = append(order, name)
+		}
+		stop.Names = append(stop.Names, keyName(rec["name"]))
+		if rec["latitude"] != "" || rec["longitude"] != "" {
+			lat, err := strconv.ParseFloat(rec["latitude"], 64)
+			if err != nil {
+				return []Stop{}, err
+			}
+			long, err := strconv.ParseFloat(rec["longitude"], 64)
+			if err != nil {
+				return []Stop{}, err
+			}
+			stop.Latitude, stop.Longitude, stop.HasLocation = lat, long, true
+		}
+		stops[name] = stop
+	}
+	var result []Stop
+	for _, name := range order {
+		result = append(result, stops[name])
+	}
+	return result, nil
+}
+
+// Name holds the stop ID corresponding to a stop name.
+type Name struct {
+	ID string `firestore:"id"`
+}
+
+// getStopID returns the ID of a stop given a name,
+// or an empty string if the stop has no existing ID.
+func getStopID(ctx context.Context, names []string, client *firestore.Client) (string, error) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		doc, err := client.Collection("stopNames").Doc(name).Get(ctx)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return "", err
+		}
+		if doc.Exists() {
+			var name Name
+			doc.DataTo(&name)
+			return name.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// uploadStop adds or updates a stop in the database,
+// and adds or updates stop name to stop ID mappings.
+func uploadStop(ctx context.Context, stop Stop, client *firestore.Client) error {
+	data := map[string]interface{}{
+		"displayName": stop.DisplayName,
+	}
+	if stop.HasLocation {
+		data["latitude"] = stop.Latitude
+		data["longitude"] = stop.Longitude
+	}
+	id, err := getStopID(ctx, stop.Names, client)
+	if err != nil {
+		return err
+	}
+
+	stopsRef := client.Collection("stops")
+	batch := client.Batch()
+	var docRef *firestore.DocumentRef
+	if id == "" {
+		// New stop
+		docRef = stopsRef.NewDoc()
+		id = docRef.ID
+	} else {
+		// Existing stop, e.g. one added by the DC gov database load
+		docRef = stopsRef.Doc(id)
+	}
+	batch.Set(docRef, data, firestore.MergeAll)
+
+	namesRef := client.Collection("stopNames")
+	for _, name := range stop.Names {
+		if name == "" {
+			continue
+		}
+		batch.Set(namesRef.Doc(name), map[string]string{
+			"id": id,
+		})
+	}
+	_, err = batch.Commit(ctx)
+	return err
+}
+
+// uploadStops uploads a collection of stops to the database.
+func uploadStops(stops []Stop, project string) error {
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, project)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, stop := range stops {
+		log.Print(stop.DisplayName)
+		err = uploadStop(ctx, stop, client)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	file, err := os.Open("stops.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+	stops, err := readStops(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	project := os.Getenv("PROJECT")
+	err = uploadStops(stops, project)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
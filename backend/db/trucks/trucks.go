@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"encoding/csv"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 
 	"cloud.google.com/go/firestore"
@@ -77,6 +79,10 @@ func readTrucks(file io.Reader) ([]Truck, error) {
 	for _, v := range trucks {
 		result = append(result, v)
 	}
+	// Sort the trucks so they are written in the same order on each run.
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DisplayName < result[j].DisplayName
+	})
 	return result, nil
 }
 
@@ -86,8 +92,15 @@ type Name struct {
 }
 
 // getTruckID returns the ID of a food truck given a name,
-// or an empty string if the truck has no existing ID.
-func getTruckID(ctx context.Context, names []string, client *firestore.Client) (string, error) {
+// or an empty string if the truck has no existing ID. `known` maps the
+// names written in this run to their IDs, since names in a batch which is
+// not yet committed are not in the database.
+func getTruckID(ctx context.Context, names []string, known map[string]string, client *firestore.Client) (string, error) {
+	for _, name := range names {
+		if id, ok := known[name]; ok {
+			return id, nil
+		}
+	}
 	for _, name := range names {
 		if name == "" {
 			continue
@@ -105,46 +118,110 @@ func getTruckID(ctx context.Context, names []string, client *firestore.Client) (
 	return "", nil
 }
 
+// maxBatchWrites is the most writes Firestore allows in one batch.
+const maxBatchWrites = 500
+
+// batchWriter splits writes into batches of at most maxBatchWrites, as
+// loaddb.BatchWriter does. A run which fails part way is not resumed but
+// run again: trucks and names committed before the failure are found by
+// name, so they are updated rather than added twice.
+type batchWriter struct {
+	client    *firestore.Client
+	batch     *firestore.WriteBatch
+	size      int
+	committed int
+}
+
+func newBatchWriter(client *firestore.Client) *batchWriter {
+	return &batchWriter{client: client, batch: client.Batch()}
+}
+
+// reserve commits the current batch if it does not have room for n more
+// writes, so that writes which must be made together are in one batch.
+func (w *batchWriter) reserve(ctx context.Context, n int) error {
+	if w.size+n > maxBatchWrites {
+		return w.flush(ctx)
+	}
+	return nil
+}
+
+// set adds a write to the batch, committing the batch first if it is full.
+func (w *batchWriter) set(ctx context.Context, ref *firestore.DocumentRef, data interface{}, opts ...firestore.SetOption) error {
+	if w.size == maxBatchWrites {
+		if err := w.flush(ctx); err != nil {
+			return err
+		}
+	}
+	w.batch.Set(ref, data, opts...)
+	w.size++
+	return nil
+}
+
+// flush commits the writes in the current batch, if any.
+func (w *batchWriter) flush(ctx context.Context) error {
+	if w.size == 0 {
+		return nil
+	}
+	if _, err := w.batch.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed after committing %d writes: %v", w.committed, err)
+	}
+	w.committed += w.size
+	w.batch = w.client.Batch()
+	w.size = 0
+	log.Printf("Committed %d writes", w.committed)
+	return nil
+}
+
 // uploadTruck adds or updates a truck in the database,
-// and adds or updates truck name to truck ID mappings.
-func uploadTruck(ctx context.Context, truck Truck, client *firestore.Client) error {
+// and adds or updates truck name to truck ID mappings. The names are added
+// to `known`.
+func uploadTruck(ctx context.Context, truck Truck, client *firestore.Client, w *batchWriter, known map[string]string) error {
 	data := map[string]interface{}{
 		"displayName": truck.DisplayName,
 		"twitter":     truck.Twitter,
 	}
-	id, err := getTruckID(ctx, truck.Names, client)
+	id, err := getTruckID(ctx, truck.Names, known, client)
 	if err != nil {
 		return err
 	}
 
+	var names []string
+	for _, name := range truck.Names {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	// Keep the truck and its names in one batch, so a failure never leaves
+	// a truck without names.
+	if err := w.reserve(ctx, 1+len(names)); err != nil {
+		return err
+	}
+
 	trucksRef := client.Collection("trucks")
-	batch := client.Batch()
+	var docRef *firestore.DocumentRef
 	if id == "" {
 		// New truck
 		// TODO: Check for and handle ID collisions.
-		docRef := trucksRef.NewDoc()
-		batch.Set(docRef, data, firestore.MergeAll)
+		docRef = trucksRef.NewDoc()
 		id = docRef.ID
 	} else {
 		// Existing truck
 		// TODO: Avoid overwriting data, e.g. Twitter, with empty strings.
-		docRef := trucksRef.Doc(id)
-		batch.Set(docRef, data, firestore.MergeAll)
+		docRef = trucksRef.Doc(id)
+	}
+	if err := w.set(ctx, docRef, data, firestore.MergeAll); err != nil {
+		return err
 	}
 
 	namesRef := client.Collection("truckNames")
-	for _, name := range truck.Names {
-		if name == "" {
-			continue
-		}
-		docRef := namesRef.Doc(name)
-		batch.Set(docRef, map[string]string{
+	for _, name := range names {
+		err := w.set(ctx, namesRef.Doc(name), map[string]string{
 			"id": id,
 		})
-	}
-	_, err = batch.Commit(ctx)
-	if err != nil {
-		return err
+		if err != nil {
+			return err
+		}
+		known[name] = id
 	}
 	return nil
 }
@@ -158,14 +235,16 @@ func uploadTrucks(trucks []Truck, project string) error {
 	}
 	defer client.Close()
 
+	w := newBatchWriter(client)
+	known := make(map[string]string)
 	for _, truck := range trucks {
 		log.Print(truck.DisplayName)
-		err = uploadTruck(ctx, truck, client)
+		err = uploadTruck(ctx, truck, client, w, known)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	return w.flush(ctx)
 }
 
 func main() {
@@ -0,0 +1,262 @@
+// Package blob stores named objects, e.g. PDFs and CSVs, in either Google
+// Cloud Storage or a directory on the local filesystem.
+package blob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// ErrNotExist is returned when an object does not exist.
+var ErrNotExist = errors.New("Object does not exist")
+
+// Attrs holds the attributes of a stored object.
+type Attrs struct {
+	Name    string
+	Size    int64
+	Updated time.Time
+	// Metadata holds the key/value pairs saved with the object, if any.
+	Metadata map[string]string
+}
+
+// A Store saves and retrieves objects by name.
+type Store interface {
+	// Put saves the contents of r under the given name, along with optional
+	// metadata, replacing any existing object and its metadata.
+	Put(ctx context.Context, name string, r io.Reader, metadata map[string]string) error
+	// Get returns the contents of the named object.
+	Get(ctx context.Context, name string) ([]byte, error)
+	// List returns the names of all objects starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Stat returns the attributes of the named object.
+	Stat(ctx context.Context, name string) (Attrs, error)
+}
+
+// GCS is a Store backed by a Google Cloud Storage bucket.
+type GCS struct {
+	client *storage.Client
+	bucket string
+}
+
+// NewGCS returns a Store for the given Google Cloud Storage bucket.
+// The caller must call Close when done.
+func NewGCS(ctx context.Context, bucket string) (*GCS, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GCS{client: client, bucket: bucket}, nil
+}
+
+// Close closes the underlying storage client.
+func (s *GCS) Close() error {
+	return s.client.Close()
+}
+
+// Put saves the contents of r under the given name, along with metadata.
+func (s *GCS) Put(ctx context.Context, name string, r io.Reader, metadata map[string]string) error {
+	wc := s.client.Bucket(s.bucket).Object(name).NewWriter(ctx)
+	wc.Metadata = metadata
+	if _, err := io.Copy(wc, r); err != nil {
+		wc.Close()
+		return err
+	}
+	return wc.Close()
+}
+
+// Get returns the contents of the named object.
+func (s *GCS) Get(ctx context.Context, name string) ([]byte, error) {
+	rc, err := s.client.Bucket(s.bucket).Object(name).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// List returns the names of all objects starting with prefix.
+func (s *GCS) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	it := s.client.Bucket(s.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, attrs.Name)
+	}
+	return names, nil
+}
+
+// Stat returns the attributes of the named object.
+func (s *GCS) Stat(ctx context.Context, name string) (Attrs, error) {
+	attrs, err := s.client.Bucket(s.bucket).Object(name).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return Attrs{}, ErrNotExist
+	}
+	if err != nil {
+		return Attrs{}, err
+	}
+	return Attrs{
+		Name:     attrs.Name,
+		Size:     attrs.Size,
+		Updated:  attrs.Updated,
+		Metadata: attrs.Metadata,
+	}, nil
+}
+
+// Dir is a Store backed by a directory on the local filesystem.
+// Object names may contain slashes, which map to subdirectories. Metadata is
+// kept in a hidden JSON file next to each object.
+type Dir struct {
+	root string
+}
+
+// NewDir returns a Store that keeps objects under the directory root.
+// The directory is created on the first Put if it does not exist.
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+// path returns the filesystem path for an object name, or an error if the
+// name would refer to a file outside of the root directory.
+func (s *Dir) path(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." ||
+		strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.New("Invalid object name: " + name)
+	}
+	return filepath.Join(s.root, clean), nil
+}
+
+// metaPath returns the path of the metadata file for the object at p.
+func metaPath(p string) string {
+	return filepath.Join(filepath.Dir(p), "."+filepath.Base(p)+".meta")
+}
+
+// Put saves the contents of r under the given name, along with metadata.
+func (s *Dir) Put(ctx context.Context, name string, r io.Reader, metadata map[string]string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never see a partial object.
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return err
+	}
+	if len(metadata) == 0 {
+		if err := os.Remove(metaPath(p)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	meta, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metaPath(p), meta, 0644)
+}
+
+// Get returns the contents of the named object.
+func (s *Dir) Get(ctx context.Context, name string) ([]byte, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	return data, err
+}
+
+// List returns the names of all objects starting with prefix.
+func (s *Dir) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(s.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == s.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		// Skip temporary and metadata files.
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Stat returns the attributes of the named object.
+func (s *Dir) Stat(ctx context.Context, name string) (Attrs, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return Attrs{}, err
+	}
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return Attrs{}, ErrNotExist
+	}
+	if err != nil {
+		return Attrs{}, err
+	}
+	attrs := Attrs{Name: name, Size: info.Size(), Updated: info.ModTime()}
+	meta, err := ioutil.ReadFile(metaPath(p))
+	if os.IsNotExist(err) {
+		return attrs, nil
+	}
+	if err != nil {
+		return Attrs{}, err
+	}
+	if err := json.Unmarshal(meta, &attrs.Metadata); err != nil {
+		return Attrs{}, err
+	}
+	return attrs, nil
+}
@@ -0,0 +1,94 @@
+package blob
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	store := NewDir(root)
+
+	names, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List returned error on an empty store: %v", err)
+	}
+	if len(names) != 0 {
+		t.Fatal("List returned names from an empty store")
+	}
+
+	meta := map[string]string{"month": "2019-07"}
+	if err := store.Put(ctx, "Jul 2019.pdf", strings.NewReader("foo"), meta); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	if err := store.Put(ctx, "sub/Aug 2019.csv", strings.NewReader("barbaz"), nil); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+
+	data, err := store.Get(ctx, "Jul 2019.pdf")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if string(data) != "foo" {
+		t.Fatalf("Get returned wrong data: %s", data)
+	}
+
+	attrs, err := store.Stat(ctx, "sub/Aug 2019.csv")
+	if err != nil {
+		t.Fatalf("Stat returned error: %v", err)
+	}
+	if attrs.Size != 6 || attrs.Metadata != nil {
+		t.Fatalf("Stat returned wrong attributes: %+v", attrs)
+	}
+
+	attrs, err = store.Stat(ctx, "Jul 2019.pdf")
+	if err != nil {
+		t.Fatalf("Stat returned error: %v", err)
+	}
+	if attrs.Metadata["month"] != "2019-07" {
+		t.Fatalf("Stat returned wrong metadata: %v", attrs.Metadata)
+	}
+
+	names, err = store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("List returned wrong names: %v", names)
+	}
+
+	// Replacing an object without metadata removes its old metadata.
+	if err := store.Put(ctx, "Jul 2019.pdf", strings.NewReader("foo"), nil); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	if attrs, _ := store.Stat(ctx, "Jul 2019.pdf"); attrs.Metadata != nil {
+		t.Fatalf("Put did not replace metadata: %v", attrs.Metadata)
+	}
+
+	names, err = store.List(ctx, "sub/")
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(names) != 1 || names[0] != "sub/Aug 2019.csv" {
+		t.Fatalf("List returned wrong names: %v", names)
+	}
+
+	if _, err := store.Get(ctx, "missing.pdf"); err != ErrNotExist {
+		t.Fatalf("Get returned wrong error for a missing object: %v", err)
+	}
+	if _, err := store.Stat(ctx, "missing.pdf"); err != ErrNotExist {
+		t.Fatalf("Stat returned wrong error for a missing object: %v", err)
+	}
+	if err := store.Put(ctx, "../escape.pdf", strings.NewReader(""), nil); err == nil {
+		t.Fatal("Put failed to return an error for a name outside the root")
+	}
+}
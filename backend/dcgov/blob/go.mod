@@ -0,0 +1,10 @@
+module foodtrucks/dcgov/blob
+
+go 1.12
+
+require (
+	cloud.google.com/go v0.40.0
+	golang.org/x/net v0.0.0-20190613194153-d28f0bde5980 // indirect
+	google.golang.org/api v0.6.0
+	google.golang.org/grpc v1.20.1 // indirect
+)
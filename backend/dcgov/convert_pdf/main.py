@@ -1,9 +1,19 @@
+import argparse
 import csv
+import datetime
 import os
+import shutil
 
 import camelot
+from google.cloud import firestore
 from google.cloud import storage
 
+# The retry policy for failed files, which must match the one in get_pdfs
+# and load_db. TestRetryPolicyMatches in load_db checks it.
+MAX_ATTEMPTS = 5
+RETRY_BASE = datetime.timedelta(hours=1)
+RETRY_MAX = datetime.timedelta(hours=24)
+
 
 def get_file(name, bucket, out):
     """get_file downloads a file from Google Cloud Storage.
@@ -47,19 +57,70 @@ def convert_pdf_to_csv(name, out):
     return path
 
 
-def save_file(name, bucket):
+def save_file(name, bucket, metadata=None):
     """save_file saves a file to a GCS bucket.
 
     Args:
         name (str): The path to the file on disk.
         bucket (str): The name of the GCS bucket to write to.
+        metadata (dict): Optional custom metadata to save with the file.
     """
     storage_client = storage.Client()
     b = storage_client.get_bucket(bucket)
     f = b.blob(os.path.basename(name))
+    f.metadata = metadata
     f.upload_from_filename(name)
 
 
+def retry_delay(attempts):
+    """retry_delay returns how long to wait before retrying a file.
+
+    Args:
+        attempts (int): The number of times the file has failed.
+
+    Returns:
+        datetime.timedelta: The time to wait.
+    """
+    return min(RETRY_BASE * 2 ** (attempts - 1), RETRY_MAX)
+
+
+def record_failure(name, err):
+    """record_failure records in the file's dcGovFiles document that it
+    failed to convert, so that it is retried later or dead-lettered.
+
+    Args:
+        name (str): The key of the file that failed.
+        err (Exception): The error it failed with.
+    """
+    client = firestore.Client()
+    ref = client.collection('dcGovFiles').document(os.path.splitext(os.path.basename(name))[0])
+
+    @firestore.transactional
+    def update(transaction):
+        snap = ref.get(transaction=transaction)
+        status = snap.to_dict() if snap.exists else {}
+        now = datetime.datetime.now(datetime.timezone.utc)
+        attempts = status.get('attempts', 0) + 1
+        data = {
+            'ok': False,
+            'attempts': attempts,
+            'stage': 'convert',
+            'lastError': str(err),
+            'lastAttempt': now,
+        }
+        if not status.get('firstAttempt'):
+            data['firstAttempt'] = now
+        if attempts >= MAX_ATTEMPTS:
+            data['state'] = 'dead'
+            data['nextAttempt'] = None
+        else:
+            data['state'] = 'retry'
+            data['nextAttempt'] = now + retry_delay(attempts)
+        transaction.set(ref, data, merge=True)
+
+    update(client.transaction())
+
+
 def convert_pdf(event, context):
     """convert_pdf converts a PDF to CSV and writes it back to Google Cloud Storage.
     
@@ -73,6 +134,57 @@ def convert_pdf(event, context):
     if os.path.splitext(name)[1] != '.pdf':
         return
     folder = '/tmp'
-    pdf = get_file(name, bucket, folder)
-    csv = convert_pdf_to_csv(pdf, folder)
-    save_file(csv, bucket)
+    try:
+        pdf = get_file(name, bucket, folder)
+        csv = convert_pdf_to_csv(pdf, folder)
+        # Keep the PDF's metadata, e.g. the month it covers, with the CSV.
+        save_file(csv, bucket, event.get('metadata'))
+    except Exception as e:
+        print(f'Converting {name} failed: {e}')
+        record_failure(name, e)
+        raise
+
+
+def meta_path(path):
+    """meta_path returns the path of the metadata file for a file in a local
+    directory, where the Go blob package's directory store keeps it.
+
+    Args:
+        path (str): The path to the file on disk.
+
+    Returns:
+        str: The path to its metadata file.
+    """
+    return os.path.join(os.path.dirname(path), '.' + os.path.basename(path) + '.meta')
+
+
+def convert_dir(folder):
+    """convert_dir converts each PDF in a local folder which has no CSV yet,
+    for running without Google Cloud. The PDF's metadata is kept with the CSV.
+
+    Args:
+        folder (str): The folder holding the PDFs, e.g. as saved by get_pdfs
+            with -dir.
+    """
+    for name in sorted(os.listdir(folder)):
+        if os.path.splitext(name)[1] != '.pdf':
+            continue
+        pdf = os.path.join(folder, name)
+        if os.path.exists(os.path.splitext(pdf)[0] + '.csv'):
+            continue
+        print(f'Processing {name}')
+        try:
+            path = convert_pdf_to_csv(pdf, folder)
+        except Exception as e:
+            print(f'Converting {name} failed: {e}')
+            continue
+        if os.path.exists(meta_path(pdf)):
+            shutil.copyfile(meta_path(pdf), meta_path(path))
+
+
+if __name__ == '__main__':
+    parser = argparse.ArgumentParser(description='Convert lottery result PDFs to CSVs.')
+    parser.add_argument('-dir', required=True,
+                        help='convert the PDFs in this local directory instead of the bucket')
+    args = parser.parse_args()
+    convert_dir(args.dir)
@@ -0,0 +1,122 @@
+// Command files lists the processing status of DC government files and
+// requeues failed files to be retried.
+//
+//	files list [-state dead]
+//	files requeue [-dead] [name ...]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"foodtrucks/dcgov/getpdfs"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: files list [-state state]")
+	fmt.Fprintln(os.Stderr, "       files requeue [-dead] [name ...]")
+	os.Exit(2)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// list prints the status of files in the given state, or of all files.
+func list(ctx context.Context, db getpdfs.DB, state string) error {
+	var states []string
+	if state != "" {
+		states = append(states, state)
+	}
+	files, err := db.ListFiles(ctx, states...)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := files[name]
+		fmt.Printf("%s\t%s\tattempts=%d\tstage=%s\tlast=%s\tnext=%s\n",
+			name, s.State, s.Attempts, s.Stage, formatTime(s.LastAttempt), formatTime(s.NextAttempt))
+		if s.LastError != "" {
+			fmt.Printf("\t%s\n", s.LastError)
+		}
+	}
+	return nil
+}
+
+// requeue marks the given files, and all dead files if `dead` is set, to be
+// retried on the next run.
+func requeue(ctx context.Context, db getpdfs.DB, names []string, dead bool) error {
+	if dead {
+		files, err := db.ListFiles(ctx, getpdfs.FileDead)
+		if err != nil {
+			return err
+		}
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	now := time.Now()
+	for _, name := range names {
+		s, ok, err := db.GetFileStatus(ctx, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("No file %s", name)
+		}
+		if err := db.SetFileStatus(ctx, name, s.Requeue(now)); err != nil {
+			return err
+		}
+		log.Printf("Requeued %s", name)
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	ctx := context.Background()
+	project := os.Getenv("PROJECT")
+
+	db, err := getpdfs.NewFirestoreDB(ctx, project)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer db.Close()
+
+	switch os.Args[1] {
+	case "list":
+		flags := flag.NewFlagSet("list", flag.ExitOnError)
+		state := flags.String("state", "", "only list files in this state: processing, ok, retry or dead")
+		flags.Parse(os.Args[2:])
+		err = list(ctx, db, *state)
+	case "requeue":
+		flags := flag.NewFlagSet("requeue", flag.ExitOnError)
+		dead := flags.Bool("dead", false, "requeue all dead files")
+		flags.Parse(os.Args[2:])
+		if !*dead && flags.NArg() == 0 {
+			usage()
+		}
+		err = requeue(ctx, db, flags.Args(), *dead)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+}
@@ -1,16 +1,70 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
 	"log"
 
+	"foodtrucks/dcgov/blob"
 	"foodtrucks/dcgov/getpdfs"
+
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
+	dir := flag.String("dir", "", "save PDFs to this local directory instead of the bucket, and keep state in memory instead of Firestore")
+	sqlitePath := flag.String("sqlite", "", "keep state in this SQLite database file instead of Firestore, or memory if -dir is set")
+	head := flag.Bool("head", false, "send HEAD requests to check whether links on the same site without an extension are PDFs")
+	flag.Parse()
+
+	ctx := context.Background()
 	url := "https://dcra.dc.gov/mrv"
-	bucket := "davidkretch-test"
 	project := "serene-foundry-234813"
-	err := getpdfs.GetPDFs(url, bucket, project)
+
+	var bucket blob.Store
+	if *dir != "" {
+		bucket = blob.NewDir(*dir)
+	} else {
+		gcs, err := blob.NewGCS(ctx, "davidkretch-test")
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		defer gcs.Close()
+		bucket = gcs
+	}
+
+	var db getpdfs.DB
+	switch {
+	case *sqlitePath != "":
+		conn, err := sql.Open("sqlite3", *sqlitePath)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		defer conn.Close()
+		sqlite, err := getpdfs.NewSQLiteDB(ctx, conn)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		db = sqlite
+	case *dir != "":
+		db = getpdfs.NewMemoryDB()
+	default:
+		fs, err := getpdfs.NewFirestoreDB(ctx, project)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		defer fs.Close()
+		db = fs
+	}
+
+	fetcher := getpdfs.NewFetcher(nil)
+	classifier := &getpdfs.Classifier{}
+	if *head {
+		classifier.Fetcher = fetcher
+	}
+
+	err := getpdfs.GetPDFs(ctx, fetcher, classifier, url, bucket, db)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"os"
 
+	"foodtrucks/dcgov/blob"
 	"foodtrucks/dcgov/getpdfs"
 )
 
@@ -17,8 +18,16 @@ type PubSubMessage struct {
 // GetPDFs gets new PDFs from the given URL and stores them in a bucket.
 func GetPDFs(ctx context.Context, m PubSubMessage) error {
 	url := os.Getenv("URL")
-	bucket := os.Getenv("BUCKET")
-	project := os.Getenv("PROJECT")
-	err := getpdfs.GetPDFs(url, bucket, project)
+	bucket, err := blob.NewGCS(ctx, os.Getenv("BUCKET"))
+	if err != nil {
+		return err
+	}
+	defer bucket.Close()
+	db, err := getpdfs.NewFirestoreDB(ctx, os.Getenv("PROJECT"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	err = getpdfs.GetPDFs(ctx, getpdfs.NewFetcher(nil), &getpdfs.Classifier{}, url, bucket, db)
 	return err
 }
@@ -0,0 +1,33 @@
+package getpdfs
+
+import (
+	"context"
+	"time"
+)
+
+// PageState holds what was seen the last time a page was fetched, so that
+// unchanged pages can be skipped.
+type PageState struct {
+	URL          string    `firestore:"url"`
+	ETag         string    `firestore:"etag"`
+	LastModified string    `firestore:"lastModified"`
+	LinksHash    string    `firestore:"linksHash"`
+	Checked      time.Time `firestore:"checked"`
+}
+
+// DB stores the processing status of files and the state of fetched pages.
+type DB interface {
+	// GetFileStatus returns the processing status of the file with the
+	// given name, not including file extension, and whether it has one.
+	GetFileStatus(ctx context.Context, file string) (FileStatus, bool, error)
+	// SetFileStatus records the processing status of a file.
+	SetFileStatus(ctx context.Context, file string, status FileStatus) error
+	// ListFiles returns the status of each file in one of the given
+	// states, or of all files if no states are given, keyed by name.
+	ListFiles(ctx context.Context, states ...string) (map[string]FileStatus, error)
+	// PageState returns the last seen state of the page at url, or a zero
+	// PageState if it has not been seen.
+	PageState(ctx context.Context, url string) (PageState, error)
+	// SetPageState records the last seen state of a page.
+	SetPageState(ctx context.Context, state PageState) error
+}
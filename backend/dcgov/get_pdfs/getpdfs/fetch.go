@@ -0,0 +1,151 @@
+package getpdfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A Fetcher gets documents over HTTP, retrying with exponential backoff when
+// a request fails or the server responds with a 5xx or 429 status.
+type Fetcher struct {
+	// Client is the HTTP client used to make requests.
+	Client *http.Client
+	// MaxRetries is the maximum number of retries after the first attempt.
+	MaxRetries int
+	// MinBackoff is the wait before the first retry. Each later retry waits
+	// twice as long as the one before, up to MaxBackoff, with random jitter.
+	MinBackoff time.Duration
+	// MaxBackoff is the longest wait between two attempts.
+	MaxBackoff time.Duration
+	// MaxDuration is the longest time to spend on a request, including all
+	// retries. Zero means no limit.
+	MaxDuration time.Duration
+}
+
+// NewFetcher returns a Fetcher with default retry settings using client,
+// or a client with a 30 second timeout if client is nil.
+func NewFetcher(client *http.Client) *Fetcher {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Fetcher{
+		Client:      client,
+		MaxRetries:  5,
+		MinBackoff:  500 * time.Millisecond,
+		MaxBackoff:  30 * time.Second,
+		MaxDuration: 2 * time.Minute,
+	}
+}
+
+// StatusError is returned when a server responds with an unsuccessful status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// retryable returns whether a request that got the given status code may
+// succeed if retried.
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff returns how long to wait before the given retry, starting from 0.
+func (f *Fetcher) backoff(retry int) time.Duration {
+	d := f.MinBackoff
+	for i := 0; i < retry && d < f.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > f.MaxBackoff {
+		d = f.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// Wait between half and all of the backoff so that clients which failed
+	// together do not retry together.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter returns the wait requested by a Retry-After header, given either
+// in seconds or as an HTTP date, or false if there is none.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Get returns the response for a GET request to u. A response is only
+// returned if it has a 2xx status; the caller must close its body.
+func (f *Fetcher) Get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f.Do(ctx, req)
+}
+
+// Do sends req, retrying on errors, and returns the response. A response is
+// only returned if it has a 2xx status, or a 304 status for a conditional
+// request; the caller must close its body.
+// Requests with a body cannot be retried and are sent once.
+func (f *Fetcher) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	var err error
+	for retry := 0; ; retry++ {
+		var resp *http.Response
+		resp, err = f.Client.Do(req.WithContext(ctx))
+		wait := f.backoff(retry)
+		if err == nil {
+			code := resp.StatusCode
+			if code/100 == 2 || code == http.StatusNotModified {
+				return resp, nil
+			}
+			err = &StatusError{URL: req.URL.String(), StatusCode: code}
+			if d, ok := retryAfter(resp.Header, time.Now()); ok {
+				wait = d
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if !retryable(code) {
+				return nil, err
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if retry >= f.MaxRetries || req.Body != nil {
+			return nil, err
+		}
+		if f.MaxDuration > 0 && time.Since(start)+wait > f.MaxDuration {
+			return nil, err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
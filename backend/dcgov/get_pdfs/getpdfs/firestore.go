@@ -0,0 +1,120 @@
+package getpdfs
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// FirestoreDB is a DB backed by Cloud Firestore. File statuses are kept in
+// the dcGovFiles collection and page states in the dcGovPages collection.
+type FirestoreDB struct {
+	client *firestore.Client
+}
+
+// NewFirestoreDB returns a DB for the given Google Cloud project.
+// The caller must call Close when done.
+func NewFirestoreDB(ctx context.Context, project string) (*FirestoreDB, error) {
+	client, err := firestore.NewClient(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	return &FirestoreDB{client: client}, nil
+}
+
+// Close closes the underlying Firestore client.
+func (db *FirestoreDB) Close() error {
+	return db.client.Close()
+}
+
+// GetFileStatus returns the processing status of a file.
+func (db *FirestoreDB) GetFileStatus(ctx context.Context, file string) (FileStatus, bool, error) {
+	snap, err := db.client.Collection("dcGovFiles").Doc(file).Get(ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return FileStatus{}, false, nil
+	}
+	if err != nil {
+		return FileStatus{}, false, err
+	}
+	var status FileStatus
+	if err := snap.DataTo(&status); err != nil {
+		return FileStatus{}, false, err
+	}
+	return status, true, nil
+}
+
+// SetFileStatus records the processing status of a file. Fields written
+// by other stages, e.g. provenance written by the load, are kept.
+func (db *FirestoreDB) SetFileStatus(ctx context.Context, file string, status FileStatus) error {
+	_, err := db.client.Collection("dcGovFiles").Doc(file).Set(ctx, map[string]interface{}{
+		"ok":           status.OK,
+		"state":        status.State,
+		"attempts":     status.Attempts,
+		"stage":        status.Stage,
+		"lastError":    status.LastError,
+		"firstAttempt": status.FirstAttempt,
+		"lastAttempt":  status.LastAttempt,
+		"nextAttempt":  status.NextAttempt,
+		"sourceUrl":    status.SourceURL,
+	}, firestore.MergeAll)
+	return err
+}
+
+// ListFiles returns the status of each file in one of the given states.
+func (db *FirestoreDB) ListFiles(ctx context.Context, states ...string) (map[string]FileStatus, error) {
+	var queries []firestore.Query
+	for _, state := range states {
+		queries = append(queries, db.client.Collection("dcGovFiles").Where("state", "==", state))
+	}
+	if len(states) == 0 {
+		queries = append(queries, db.client.Collection("dcGovFiles").Query)
+	}
+	files := make(map[string]FileStatus)
+	for _, q := range queries {
+		docs, err := q.Documents(ctx).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			var status FileStatus
+			if err := doc.DataTo(&status); err != nil {
+				return nil, err
+			}
+			files[doc.Ref.ID] = status
+		}
+	}
+	return files, nil
+}
+
+// pageDoc returns the document holding the state of the page at url.
+// URLs contain slashes, so documents are keyed by a hash of the URL.
+func (db *FirestoreDB) pageDoc(url string) *firestore.DocumentRef {
+	sum := sha1.Sum([]byte(url))
+	return db.client.Collection("dcGovPages").Doc(hex.EncodeToString(sum[:]))
+}
+
+// PageState returns the last seen state of the page at url.
+func (db *FirestoreDB) PageState(ctx context.Context, url string) (PageState, error) {
+	snap, err := db.pageDoc(url).Get(ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return PageState{URL: url}, nil
+	}
+	if err != nil {
+		return PageState{}, err
+	}
+	var state PageState
+	if err := snap.DataTo(&state); err != nil {
+		return PageState{}, err
+	}
+	return state, nil
+}
+
+// SetPageState records the last seen state of a page.
+func (db *FirestoreDB) SetPageState(ctx context.Context, state PageState) error {
+	_, err := db.pageDoc(state.URL).Set(ctx, state)
+	return err
+}
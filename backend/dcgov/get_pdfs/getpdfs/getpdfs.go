@@ -1,78 +1,120 @@
 package getpdfs
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
-	"cloud.google.com/go/firestore"
-	"cloud.google.com/go/storage"
 	"golang.org/x/net/html"
+
+	"foodtrucks/dcgov/blob"
 )
 
-// GetURL returns a document from a URL, retrying in case of error.
+// GetURL returns a document from a URL using a Fetcher with default
+// settings, retrying in case of error.
 func GetURL(u string) (*http.Response, error) {
-	var resp *http.Response
-	var err error
-	retries := 5
-	for retries > 0 {
-		retries--
-		resp, err = http.Get(u)
-		if err == nil {
-			break
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
-	return resp, err
+	return NewFetcher(nil).Get(context.Background(), u)
 }
 
-// A Link stores the URL and text for a link in an HTML document.
+// A Link stores the URL and text for a link in an HTML document, along with
+// metadata which may describe the linked file, e.g. the month of a lottery.
 type Link struct {
+	// Text is the link's text, with whitespace normalized.
 	Text string
 	URL  string
+	// Title is the link's title attribute.
+	Title string
+	// Label is the link's aria-label attribute.
+	Label string
+	// Heading is the text of the nearest heading before the link.
+	Heading string
 }
 
 // GetLinks returns all links in the given document.
 func GetLinks(r io.Reader) []Link {
+	links, _ := getLinks(r)
+	return links
+}
+
+// headings are the tags whose text is recorded as a Link's Heading.
+var headings = map[string]bool{
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// normalizeSpace returns s with runs of whitespace replaced by single spaces
+// and leading and trailing whitespace removed.
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// getLinks returns all links in the given document, along with the href of
+// the document's <base> tag, if any.
+func getLinks(r io.Reader) ([]Link, string) {
 	var link Link
 	var links []Link
+	var text, headingText strings.Builder
+	base, heading := "", ""
+	anchor, inHeading := false, false
 	z := html.NewTokenizer(r)
-	anchor := false
 	for {
 		tt := z.Next()
 		if tt == html.ErrorToken {
 			break
 		}
 		token := z.Token()
-		if token.Data == "a" {
-			switch token.Type {
-			case html.StartTagToken:
+		switch token.Type {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch {
+			case token.Data == "base" && base == "":
+				if u, err := GetAttribute(token, "href"); err == nil {
+					base = u
+				}
+			case token.Data == "a" && token.Type == html.StartTagToken:
 				anchor = true
-				link = Link{}
-			case html.EndTagToken:
+				link = Link{Heading: heading}
+				link.URL, _ = GetAttribute(token, "href")
+				link.Title, _ = GetAttribute(token, "title")
+				link.Label, _ = GetAttribute(token, "aria-label")
+				link.Title = normalizeSpace(link.Title)
+				link.Label = normalizeSpace(link.Label)
+				text.Reset()
+			case headings[token.Data]:
+				inHeading = true
+				headingText.Reset()
+			case token.Data == "br":
+				text.WriteString(" ")
+				headingText.WriteString(" ")
+			}
+		case html.EndTagToken:
+			switch {
+			case token.Data == "a" && anchor:
 				anchor = false
+				link.Text = normalizeSpace(text.String())
 				links = append(links, link)
+			case headings[token.Data] && inHeading:
+				inHeading = false
+				heading = normalizeSpace(headingText.String())
 			}
-		}
-		if anchor {
-			switch token.Type {
-			case html.StartTagToken:
-				u, err := GetAttribute(token, "href")
-				if err == nil {
-					link.URL = u
-				}
-			case html.TextToken:
-				link.Text = token.Data
+		case html.TextToken:
+			if anchor {
+				text.WriteString(token.Data)
+			}
+			if inHeading {
+				headingText.WriteString(token.Data)
 			}
 		}
 	}
-	return links
+	return links, base
 }
 
 // GetAttribute returns the value for the given attribute key, or an error if none.
@@ -96,77 +138,146 @@ func Filter(l []Link, f func(Link) bool) []Link {
 	return (r)
 }
 
-// AlreadyProcessed returns whether a file with the given name, not including
-// file extension, has been successfully processed.
-func AlreadyProcessed(name string, project string) (bool, error) {
+// LinksHash returns a hash of the set of URLs in links, which does not
+// depend on their order.
+func LinksHash(links []Link) string {
+	var urls []string
+	for _, link := range links {
+		urls = append(urls, link.URL)
+	}
+	sort.Strings(urls)
+	h := sha256.New()
+	prev := ""
+	for i, u := range urls {
+		if i > 0 && u == prev {
+			continue
+		}
+		io.WriteString(h, u+"\n")
+		prev = u
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SaveToBucket saves the contents of file, along with metadata, to the
+// given bucket.
+func SaveToBucket(file io.Reader, name string, metadata map[string]string, bucket blob.Store) error {
 	ctx := context.Background()
-	client, err := firestore.NewClient(ctx, project)
+	return bucket.Put(ctx, name, file, metadata)
+}
+
+// GetPage fetches the page at u, sending the ETag and Last-Modified values
+// from state so that the server can respond 304 Not Modified if the page has
+// not changed. It returns a nil response if the page has not changed.
+func GetPage(ctx context.Context, fetcher *Fetcher, u string, state PageState) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	if state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
 	}
-	defer client.Close()
-	fileNoExt := strings.TrimSuffix(name, path.Ext(name))
-	fileRef := client.Collection("dcGovFiles").Doc(fileNoExt)
-	snap, err := fileRef.Get(ctx)
-	if !snap.Exists() {
-		return false, nil
+	if state.LastModified != "" {
+		req.Header.Set("If-Modified-Since", state.LastModified)
 	}
+	resp, err := fetcher.Do(ctx, req)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	data := snap.Data()
-	if ok, _ := data["ok"]; ok == true {
-		return true, nil
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, nil
 	}
-	return false, nil
+	return resp, nil
 }
 
-// SaveToBucket saves the contents of file to the given bucket.
-func SaveToBucket(file io.Reader, name string, bucket string) error {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+// fetchPDF fetches the PDF at a link and saves it in the bucket as `name`,
+// with metadata about where it came from.
+func fetchPDF(ctx context.Context, fetcher *Fetcher, link Link, name string, bucket blob.Store) error {
+	file, err := fetcher.Get(ctx, link.URL)
 	if err != nil {
 		return err
 	}
-	wc := client.Bucket(bucket).Object(name).NewWriter(ctx)
-	if _, err = io.Copy(wc, file); err != nil {
+	data, err := ioutil.ReadAll(file.Body)
+	file.Body.Close()
+	if err != nil {
 		return err
 	}
-	if err := wc.Close(); err != nil {
-		return err
+	meta := FileMetadata(link, data)
+	if meta["month"] == "" {
+		log.Printf("No month and year found for %s", name)
 	}
-	return nil
+	return SaveToBucket(bytes.NewReader(data), name, meta, bucket)
 }
 
-// GetPDFs saves all PDFs linked to from the given URL in Google Cloud Storage.
-func GetPDFs(u string, bucket string, project string) error {
-	resp, err := GetURL(u)
+// GetPDFs saves all PDFs linked to from the given URL in the given bucket,
+// using fetcher to download the page and the PDFs and classifier to decide
+// which links are PDFs. It does nothing if the page, or the set of PDFs it
+// links to, has not changed since the last run, apart from retrying files
+// which failed earlier.
+func GetPDFs(ctx context.Context, fetcher *Fetcher, classifier *Classifier, u string, bucket blob.Store, db DB) error {
+	if err := RetryFiles(ctx, fetcher, bucket, db, time.Now()); err != nil {
+		return err
+	}
+	state, err := db.PageState(ctx, u)
+	if err != nil {
+		return err
+	}
+	resp, err := GetPage(ctx, fetcher, u, state)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if resp == nil {
+		log.Printf("Page %s not modified", u)
+		return nil
 	}
 	defer resp.Body.Close()
 
-	links := GetLinks(resp.Body)
-	pdfs := Filter(links, func(l Link) bool {
-		return strings.HasSuffix(l.URL, "pdf")
-	})
+	links, err := ResolveLinks(resp.Body, resp.Request.URL.String())
+	if err != nil {
+		return err
+	}
+	pdfs, report := classifier.Classify(ctx, resp.Request.URL.String(), links)
+	for _, c := range report {
+		if !c.PDF {
+			log.Printf("Rejected link %s: %s", c.Link.URL, c.Reason)
+		}
+	}
+	log.Printf("Found %d PDFs among %d links on %s", len(pdfs), len(links), u)
+
+	newState := PageState{
+		URL:          u,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		LinksHash:    LinksHash(pdfs),
+		Checked:      time.Now(),
+	}
+	if newState.LinksHash == state.LinksHash {
+		log.Printf("No new PDFs on %s", u)
+		return db.SetPageState(ctx, newState)
+	}
 
 	for _, link := range pdfs {
-		name, _ := url.PathUnescape(path.Base(link.URL))
-		if processed, _ := AlreadyProcessed(name, project); !processed {
+		name := PDFName(link.URL)
+		if processed, _ := AlreadyProcessed(name, db); !processed {
 			log.Printf("Fetching %s", name)
-
-			file, err := GetURL(link.URL)
-			if err != nil {
-				return err
+			fileNoExt := strings.TrimSuffix(name, path.Ext(name))
+			status := FileStatus{SourceURL: link.URL}
+			if err := fetchPDF(ctx, fetcher, link, name, bucket); err != nil {
+				log.Printf("Fetching %s failed: %v", name, err)
+				status = status.Failed(StageFetch, err, time.Now())
+			} else {
+				status = status.Fetched(time.Now())
 			}
-			err = SaveToBucket(file.Body, name, bucket)
-			if err != nil {
+			if err := db.SetFileStatus(ctx, fileNoExt, status); err != nil {
 				return err
 			}
 		} else {
 			log.Printf("Skipping %s", name)
 		}
 	}
-	return nil
+
+	// Only record the new state once the status of every PDF has been
+	// saved, so that PDFs which were not fetched are fetched on the next
+	// run. Failed fetches are retried by RetryFiles.
+	return db.SetPageState(ctx, newState)
 }
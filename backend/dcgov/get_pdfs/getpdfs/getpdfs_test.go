@@ -1,14 +1,32 @@
 package getpdfs
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/net/html"
+
+	"foodtrucks/dcgov/blob"
 )
 
 func TestGet(t *testing.T) {
-	resp, err := GetURL("https://httpbin.org/get")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	resp, err := GetURL(ts.URL)
 	if err != nil {
 		t.Fatalf("Get returned error: %v", err)
 	}
@@ -40,6 +58,29 @@ func TestGetLinks(t *testing.T) {
 	}
 }
 
+func TestGetLinksMetadata(t *testing.T) {
+	doc := strings.NewReader(`<html><body>
+		<h2>Lottery <em>Results</em></h2>
+		<p><a href="x" title=" June  results "><strong>June</strong> 2020
+			Results</a></p>
+		<h3>Archive</h3>
+		<a href="y" aria-label="May 2020">May<br>2020 &amp; prior</a>
+	</body></html>`)
+	links := GetLinks(doc)
+	if len(links) != 2 {
+		t.Fatalf("GetLinks returned %d links, want 2", len(links))
+	}
+	want := []Link{
+		Link{Text: "June 2020 Results", URL: "x", Title: "June results", Heading: "Lottery Results"},
+		Link{Text: "May 2020 & prior", URL: "y", Label: "May 2020", Heading: "Archive"},
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Errorf("GetLinks returned %+v, want %+v", links[i], want[i])
+		}
+	}
+}
+
 func TestGetAttribute(t *testing.T) {
 	token := html.Token{
 		Attr: []html.Attribute{
@@ -99,3 +140,519 @@ func TestFilter(t *testing.T) {
 		t.Fatal("Filter(_, 'baz') returned other than 1 elements")
 	}
 }
+
+// testFetcher returns a Fetcher with short backoffs for use in tests.
+func testFetcher() *Fetcher {
+	f := NewFetcher(nil)
+	f.MinBackoff = time.Millisecond
+	f.MaxBackoff = 5 * time.Millisecond
+	return f
+}
+
+func TestFetcherRetry(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := testFetcher().Get(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	resp.Body.Close()
+	if calls != 3 {
+		t.Fatalf("Get made %d requests, want 3", calls)
+	}
+}
+
+func TestFetcherNoRetry(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	_, err := testFetcher().Get(context.Background(), ts.URL)
+	if err == nil {
+		t.Fatal("Get failed to return an error for a 404")
+	}
+	if se, ok := err.(*StatusError); !ok || se.StatusCode != http.StatusNotFound {
+		t.Fatalf("Get returned wrong error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Get retried a 404 %d times", calls-1)
+	}
+}
+
+func TestFetcherLimits(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	f := testFetcher()
+	f.MaxRetries = 2
+	if _, err := f.Get(context.Background(), ts.URL); err == nil {
+		t.Fatal("Get failed to return an error after all retries failed")
+	}
+	if calls != 3 {
+		t.Fatalf("Get made %d requests, want 3", calls)
+	}
+
+	// A Retry-After longer than MaxDuration gives up without waiting.
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer slow.Close()
+	f.MaxDuration = time.Second
+	start := time.Now()
+	if _, err := f.Get(context.Background(), slow.URL); err == nil {
+		t.Fatal("Get failed to return an error")
+	}
+	if time.Since(start) > f.MaxDuration {
+		t.Fatal("Get waited longer than MaxDuration")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Get(ctx, ts.URL); err == nil {
+		t.Fatal("Get failed to return an error for a canceled context")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2019, time.July, 1, 12, 0, 0, 0, time.UTC)
+	h := http.Header{}
+	if _, ok := retryAfter(h, now); ok {
+		t.Fatal("retryAfter returned a wait without a header")
+	}
+	h.Set("Retry-After", "120")
+	if d, ok := retryAfter(h, now); !ok || d != 2*time.Minute {
+		t.Fatalf("retryAfter returned wrong wait for seconds: %v", d)
+	}
+	h.Set("Retry-After", now.Add(time.Minute).Format(http.TimeFormat))
+	if d, ok := retryAfter(h, now); !ok || d != time.Minute {
+		t.Fatalf("retryAfter returned wrong wait for a date: %v", d)
+	}
+}
+
+func TestGetPDFs(t *testing.T) {
+	var pageCalls, pdfCalls int32
+	page := `<html><body><a href="%s/files/Jul%%202019.pdf">July 2019</a><a href="%s/about">About</a></body></html>`
+	etag := `"v1"`
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mrv":
+			atomic.AddInt32(&pageCalls, 1)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			fmt.Fprintf(w, page, ts.URL, ts.URL)
+		case "/files/Jul 2019.pdf":
+			atomic.AddInt32(&pdfCalls, 1)
+			w.Write([]byte("%PDF"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	root, err := ioutil.TempDir("", "getpdfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+	bucket := blob.NewDir(root)
+	db := NewMemoryDB()
+	u := ts.URL + "/mrv"
+
+	if err := GetPDFs(ctx, testFetcher(), &Classifier{}, u, bucket, db); err != nil {
+		t.Fatalf("GetPDFs returned error: %v", err)
+	}
+	if data, err := bucket.Get(ctx, "Jul 2019.pdf"); err != nil || string(data) != "%PDF" {
+		t.Fatalf("GetPDFs did not save the PDF: %v", err)
+	}
+	if attrs, _ := bucket.Stat(ctx, "Jul 2019.pdf"); attrs.Metadata["month"] != "2019-07" {
+		t.Fatalf("GetPDFs saved wrong metadata: %v", attrs.Metadata)
+	}
+	if db.Pages[u].ETag != etag || db.Pages[u].LinksHash == "" {
+		t.Fatalf("GetPDFs did not record the page state: %+v", db.Pages[u])
+	}
+	if s := db.Files["Jul 2019"]; s.State != FileProcessing || s.SourceURL != ts.URL+"/files/Jul%202019.pdf" {
+		t.Fatalf("GetPDFs recorded wrong file status: %+v", s)
+	}
+
+	// The server responds 304, so nothing more is fetched.
+	if err := GetPDFs(ctx, testFetcher(), &Classifier{}, u, bucket, db); err != nil {
+		t.Fatalf("GetPDFs returned error: %v", err)
+	}
+	if pageCalls != 2 || pdfCalls != 1 {
+		t.Fatalf("GetPDFs made %d page and %d PDF requests, want 2 and 1", pageCalls, pdfCalls)
+	}
+
+	// The page changed but links to the same PDFs, so they are not fetched.
+	etag = `"v2"`
+	if err := GetPDFs(ctx, testFetcher(), &Classifier{}, u, bucket, db); err != nil {
+		t.Fatalf("GetPDFs returned error: %v", err)
+	}
+	if pageCalls != 3 || pdfCalls != 1 {
+		t.Fatalf("GetPDFs made %d page and %d PDF requests, want 3 and 1", pageCalls, pdfCalls)
+	}
+	if db.Pages[u].ETag != etag {
+		t.Fatal("GetPDFs did not update the page state")
+	}
+}
+
+func TestRetryFiles(t *testing.T) {
+	var pdfCalls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&pdfCalls, 1) == 1 {
+			http.Error(w, "unavailable", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("%PDF"))
+	}))
+	defer ts.Close()
+
+	root, err := ioutil.TempDir("", "getpdfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+	bucket := blob.NewDir(root)
+	db := NewMemoryDB()
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	db.Files["a"] = FileStatus{State: FileRetry, Attempts: 1, SourceURL: ts.URL + "/a.pdf", NextAttempt: now}
+	db.Files["b"] = FileStatus{State: FileRetry, Attempts: 1, SourceURL: ts.URL + "/b.pdf", NextAttempt: now.Add(time.Hour)}
+	db.Files["c"] = FileStatus{State: FileProcessing, LastAttempt: now.Add(-2 * ProcessingTimeout)}
+	db.Files["d"] = FileStatus{OK: true, State: FileOK}
+
+	// The fetch of a fails, b is not due yet and c timed out.
+	if err := RetryFiles(ctx, testFetcher(), bucket, db, now); err != nil {
+		t.Fatalf("RetryFiles returned error: %v", err)
+	}
+	a := db.Files["a"]
+	if a.State != FileRetry || a.Attempts != 2 || a.Stage != StageFetch || !a.NextAttempt.Equal(now.Add(2*RetryBase)) {
+		t.Fatalf("RetryFiles recorded wrong status after a failed fetch: %+v", a)
+	}
+	if b := db.Files["b"]; b.Attempts != 1 || !b.LastAttempt.IsZero() {
+		t.Fatalf("RetryFiles retried a file which was not due: %+v", b)
+	}
+	if c := db.Files["c"]; c.State != FileRetry || c.Stage != StageConvert || c.Attempts != 1 {
+		t.Fatalf("RetryFiles recorded wrong status after a timeout: %+v", c)
+	}
+
+	// Both are due now, and their fetches succeed.
+	later := now.Add(2 * RetryBase)
+	if err := RetryFiles(ctx, testFetcher(), bucket, db, later); err != nil {
+		t.Fatalf("RetryFiles returned error: %v", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if s := db.Files[name]; s.State != FileProcessing || !s.LastAttempt.Equal(later) {
+			t.Fatalf("RetryFiles recorded wrong status for %s after a fetch: %+v", name, s)
+		}
+		if data, err := bucket.Get(ctx, name+".pdf"); err != nil || string(data) != "%PDF" {
+			t.Fatalf("RetryFiles did not save %s: %v", name, err)
+		}
+	}
+	// c is not in the bucket and has no source URL to fetch it from.
+	if c := db.Files["c"]; c.State != FileRetry || c.Attempts != 2 || c.Stage != StageFetch {
+		t.Fatalf("RetryFiles recorded wrong status for a file without a source URL: %+v", c)
+	}
+	if d := db.Files["d"]; d.State != FileOK {
+		t.Fatalf("RetryFiles changed a loaded file: %+v", d)
+	}
+}
+
+func TestFileStatus(t *testing.T) {
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	s := FileStatus{}.Fetched(now)
+	if s.State != FileProcessing || !s.FirstAttempt.Equal(now) {
+		t.Fatalf("Fetched returned %+v", s)
+	}
+	delays := []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour, 8 * time.Hour}
+	for i, delay := range delays {
+		s = s.Failed(StageConvert, fmt.Errorf("failure %d", i), now)
+		if s.State != FileRetry || s.Attempts != i+1 || !s.NextAttempt.Equal(now.Add(delay)) {
+			t.Fatalf("Failed returned %+v after %d failures", s, i+1)
+		}
+	}
+	s = s.Failed(StageLoad, fmt.Errorf("failure"), now)
+	if s.State != FileDead || s.Attempts != MaxAttempts || s.Stage != StageLoad {
+		t.Fatalf("Failed returned %+v after %d failures", s, MaxAttempts)
+	}
+	s = s.Requeue(now)
+	if s.State != FileRetry || s.Attempts != 0 || !s.NextAttempt.Equal(now) || s.LastError == "" {
+		t.Fatalf("Requeue returned %+v", s)
+	}
+	if got := retryDelay(10); got != RetryMax {
+		t.Fatalf("retryDelay(10) = %v, want %v", got, RetryMax)
+	}
+}
+
+func TestSQLiteDB(t *testing.T) {
+	ctx := context.Background()
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Each connection to ":memory:" opens a new, empty database.
+	conn.SetMaxOpenConns(1)
+	db, err := NewSQLiteDB(ctx, conn)
+	if err != nil {
+		t.Fatalf("NewSQLiteDB returned error: %v", err)
+	}
+
+	now := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	retry := FileStatus{SourceURL: "https://dcra.dc.gov/july.pdf"}.Failed(StageFetch, fmt.Errorf("timeout"), now)
+	ok := FileStatus{OK: true, State: FileOK}
+	for name, status := range map[string]FileStatus{"july": retry, "june": ok} {
+		if err := db.SetFileStatus(ctx, name, status); err != nil {
+			t.Fatalf("SetFileStatus returned error: %v", err)
+		}
+	}
+	if got, found, err := db.GetFileStatus(ctx, "july"); err != nil || !found || !reflect.DeepEqual(got, retry) {
+		t.Fatalf("GetFileStatus = %+v, %v, %v, want %+v", got, found, err, retry)
+	}
+	if _, found, err := db.GetFileStatus(ctx, "may"); err != nil || found {
+		t.Fatalf("GetFileStatus of a new file = %v, %v, want not found", found, err)
+	}
+	files, err := db.ListFiles(ctx, FileRetry, FileDead)
+	if err != nil || len(files) != 1 || !reflect.DeepEqual(files["july"], retry) {
+		t.Fatalf("ListFiles = %v, %v, want only july", files, err)
+	}
+	if files, err := db.ListFiles(ctx); err != nil || len(files) != 2 {
+		t.Fatalf("ListFiles of all files = %v, %v, want 2 files", files, err)
+	}
+
+	url := "https://dcra.dc.gov/mrv"
+	if state, err := db.PageState(ctx, url); err != nil || state != (PageState{URL: url}) {
+		t.Fatalf("PageState of a new page = %+v, %v", state, err)
+	}
+	state := PageState{URL: url, ETag: `"abc"`, LinksHash: "123", Checked: now}
+	if err := db.SetPageState(ctx, state); err != nil {
+		t.Fatalf("SetPageState returned error: %v", err)
+	}
+	if got, err := db.PageState(ctx, url); err != nil || got != state {
+		t.Fatalf("PageState = %+v, %v, want %+v", got, err, state)
+	}
+}
+
+func TestLinksHash(t *testing.T) {
+	a := []Link{Link{URL: "a.pdf"}, Link{URL: "b.pdf"}}
+	b := []Link{Link{URL: "b.pdf"}, Link{URL: "a.pdf"}, Link{URL: "a.pdf"}}
+	c := []Link{Link{URL: "a.pdf"}, Link{URL: "c.pdf"}}
+	if LinksHash(a) != LinksHash(b) {
+		t.Fatal("LinksHash depends on the order of links")
+	}
+	if LinksHash(a) == LinksHash(c) {
+		t.Fatal("LinksHash returned the same hash for different links")
+	}
+}
+
+func TestResolveLinks(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want []string
+	}{
+		{
+			doc:  `<a href="/sites/default/files/June 2020.pdf">June</a>`,
+			want: []string{"https://dcra.dc.gov/sites/default/files/June%202020.pdf"},
+		},
+		{
+			doc:  `<a href="files/June%202020.pdf">June</a>`,
+			want: []string{"https://dcra.dc.gov/files/June%202020.pdf"},
+		},
+		{
+			doc:  `<a href="//DCRA.dc.gov/June.pdf">June</a>`,
+			want: []string{"https://dcra.dc.gov/June.pdf"},
+		},
+		{
+			doc:  `<head><base href="https://os.dc.gov/files/"></head><a href="June.pdf">June</a>`,
+			want: []string{"https://os.dc.gov/files/June.pdf"},
+		},
+		{
+			doc: `<a href="/June%20%32020.pdf">June</a><a href="/June 2020.pdf#page=2">June</a>` +
+				`<a href="https://dcra.dc.gov/June%202020.pdf">June</a>`,
+			want: []string{"https://dcra.dc.gov/June%202020.pdf"},
+		},
+		{
+			doc:  `<a href="mailto:mrv@dc.gov">Email</a><a href="">Empty</a><a>None</a>`,
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		links, err := ResolveLinks(strings.NewReader(test.doc), "https://dcra.dc.gov/mrv")
+		if err != nil {
+			t.Fatalf("ResolveLinks returned error: %v", err)
+		}
+		var got []string
+		for _, link := range links {
+			got = append(got, link.URL)
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("ResolveLinks(%q) = %v, want %v", test.doc, got, test.want)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := map[string]string{
+		"https://dcra.dc.gov/files/June%202020.pdf?ver=2": "June 2020.pdf",
+		"https://dcra.dc.gov/download?id=2":               "download",
+		"https://dcra.dc.gov/":                            "",
+		"https://dcra.dc.gov":                             "",
+	}
+	for u, want := range tests {
+		if got := FileName(u); got != want {
+			t.Errorf("FileName(%q) = %q, want %q", u, got, want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" {
+			t.Errorf("Classify sent a %s request", r.Method)
+		}
+		switch r.URL.Path {
+		case "/download":
+			w.Header().Set("Content-Type", "application/pdf; charset=binary")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+		}
+	}))
+	defer ts.Close()
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Classify sent a request to another site: %s", r.URL)
+	}))
+	defer other.Close()
+
+	links := []Link{
+		Link{URL: "https://dcra.dc.gov/file.pdf"},
+		Link{URL: "https://dcra.dc.gov/file.PDF"},
+		Link{URL: "https://dcra.dc.gov/file.pdf?ver=2"},
+		Link{URL: ts.URL + "/getpdf"},
+		Link{URL: "https://dcra.dc.gov/file.docx"},
+		Link{URL: ts.URL + "/download"},
+		Link{URL: ts.URL + "/about"},
+		Link{URL: other.URL + "/share"},
+	}
+
+	page := ts.URL + "/mrv"
+	pdfs, report := (&Classifier{}).Classify(context.Background(), page, links)
+	if len(pdfs) != 3 || len(report) != len(links) {
+		t.Fatalf("Classify without HEAD returned %d PDFs, want 3", len(pdfs))
+	}
+
+	pdfs, report = (&Classifier{Fetcher: testFetcher()}).Classify(context.Background(), page, links)
+	if len(pdfs) != 4 || pdfs[3].URL != ts.URL+"/download" {
+		t.Fatalf("Classify with HEAD returned wrong PDFs: %v", pdfs)
+	}
+	for _, c := range report {
+		if c.Reason == "" {
+			t.Fatalf("Classify returned no reason for %s", c.Link.URL)
+		}
+	}
+}
+
+func TestPDFName(t *testing.T) {
+	tests := map[string]string{
+		"https://dcra.dc.gov/June%202020.pdf":   "June 2020.pdf",
+		"https://dcra.dc.gov/June.PDF?ver=2":    "June.pdf",
+		"https://dcra.dc.gov/download/june2020": "june2020-",
+		"https://dcra.dc.gov/download?id=1":     "download-",
+		"https://dcra.dc.gov/":                  "dcra.dc.gov-",
+	}
+	for u, want := range tests {
+		got := PDFName(u)
+		if strings.HasSuffix(want, "-") {
+			if !strings.HasPrefix(got, want) || len(got) != len(want)+len("01234567.pdf") {
+				t.Errorf("PDFName(%q) = %q, want %q followed by a hash", u, got, want)
+			}
+		} else if got != want {
+			t.Errorf("PDFName(%q) = %q, want %q", u, got, want)
+		}
+	}
+
+	// Download endpoints which differ only in their query must not share a
+	// name, or only the first would be fetched.
+	names := make(map[string]string)
+	for _, u := range []string{
+		"https://dcra.dc.gov/download?id=1",
+		"https://dcra.dc.gov/download?id=2",
+		"https://dcra.dc.gov/files/download",
+		"https://dcra.dc.gov/",
+		"https://dcra.dc.gov/?id=2",
+	} {
+		name := PDFName(u)
+		if other, ok := names[name]; ok {
+			t.Errorf("PDFName(%q) = PDFName(%q) = %q", u, other, name)
+		}
+		names[name] = u
+	}
+}
+
+func TestMonthYear(t *testing.T) {
+	tests := map[string]string{
+		"June 2020 Results":            "2020-06",
+		"MRV Lottery - Sept. 2019":     "2019-09",
+		"december2019":                 "2019-12",
+		"Results_Jan_2021.pdf":         "2021-01",
+		"MRV-Lottery-Results-Final":    "",
+		"Emancipation Day 2020 notice": "",
+	}
+	for s, want := range tests {
+		if got := MonthYear(s); got != want {
+			t.Errorf("MonthYear(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestPDFTitle(t *testing.T) {
+	tests := map[string]string{
+		"%PDF-1.4\n1 0 obj << /Title (MRV Lottery \\(July 2019\\)) >>":                             "MRV Lottery (July 2019)",
+		"%PDF-1.4\n1 0 obj << /Title <FEFF004A0075006C0079> >>":                                    "July",
+		"<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">Aug 2019</rdf:li></rdf:Alt></dc:title>": "Aug 2019",
+		"%PDF-1.4\n1 0 obj << /Author (DCRA) >>":                                                   "",
+	}
+	for data, want := range tests {
+		if got := PDFTitle([]byte(data)); got != want {
+			t.Errorf("PDFTitle(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
+
+func TestFileMetadata(t *testing.T) {
+	link := Link{URL: "https://dcra.dc.gov/final.pdf", Text: "Final results", Heading: "August 2019"}
+	meta := FileMetadata(link, []byte("%PDF-1.4 /Title (Sep 2019)"))
+	if meta["month"] != "2019-08" || meta["monthSource"] != "linkHeading" {
+		t.Fatalf("FileMetadata returned wrong month: %v", meta)
+	}
+	if meta["pdfTitle"] != "Sep 2019" || meta["sourceUrl"] != link.URL {
+		t.Fatalf("FileMetadata returned wrong metadata: %v", meta)
+	}
+	if len(meta["sha256"]) != 64 || meta["size"] != "26" {
+		t.Fatalf("FileMetadata returned wrong hash or size: %v", meta)
+	}
+}
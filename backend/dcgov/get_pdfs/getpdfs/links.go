@@ -0,0 +1,218 @@
+package getpdfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ResolveLinks returns all links in the given document, with each URL
+// resolved against the document's URL, or its <base> tag if it has one, and
+// normalized using NormalizeURL. Links to the same URL are returned once.
+// Links whose URL cannot be parsed are dropped.
+func ResolveLinks(r io.Reader, pageURL string) ([]Link, error) {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	links, base := getLinks(r)
+	if base != "" {
+		if b, err := page.Parse(strings.TrimSpace(base)); err == nil {
+			page = b
+		}
+	}
+	var result []Link
+	seen := make(map[string]int)
+	for _, link := range links {
+		href := strings.TrimSpace(link.URL)
+		if href == "" {
+			continue
+		}
+		u, err := page.Parse(href)
+		if err != nil {
+			continue
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+		link.URL = NormalizeURL(u)
+		if i, ok := seen[link.URL]; ok {
+			mergeLink(&result[i], link)
+			continue
+		}
+		seen[link.URL] = len(result)
+		result = append(result, link)
+	}
+	return result, nil
+}
+
+// mergeLink fills in any empty metadata in dst from src, a link to the same
+// URL found later in the document.
+func mergeLink(dst *Link, src Link) {
+	if dst.Text == "" {
+		dst.Text = src.Text
+	}
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if dst.Label == "" {
+		dst.Label = src.Label
+	}
+	if dst.Heading == "" {
+		dst.Heading = src.Heading
+	}
+}
+
+// NormalizeURL returns u in a canonical form, so that URLs which refer to
+// the same file compare equal: the host is lower case, the fragment is
+// dropped, and the path is percent-encoded only where required.
+func NormalizeURL(u *url.URL) string {
+	n := *u
+	n.Host = strings.ToLower(n.Host)
+	n.Fragment = ""
+	n.RawPath = ""
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	if n.RawQuery != "" {
+		if q, err := url.ParseQuery(n.RawQuery); err == nil {
+			n.RawQuery = q.Encode()
+		}
+	}
+	return n.String()
+}
+
+// FileName returns the unescaped name of the file a URL refers to,
+// ignoring any query string, or an empty string if its path does not name a
+// file, e.g. "https://dcra.dc.gov/".
+func FileName(rawurl string) string {
+	var name string
+	if u, err := url.Parse(rawurl); err == nil {
+		name = path.Base(u.Path)
+	} else {
+		name, _ = url.PathUnescape(path.Base(rawurl))
+	}
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// A Classification records whether a link was found to point to a PDF,
+// and why.
+type Classification struct {
+	Link   Link
+	PDF    bool
+	Reason string
+}
+
+// A Classifier decides which links point to PDFs.
+type Classifier struct {
+	// Fetcher, if not nil, is used to send a HEAD request for each link
+	// without a file extension on the same host as the page, e.g. a
+	// download endpoint, to check whether it serves a PDF. Links to other
+	// sites, e.g. social media, are not checked.
+	Fetcher *Fetcher
+}
+
+// HasPDFExt returns whether the path of rawurl ends in .pdf, ignoring case
+// and any query string or fragment.
+func HasPDFExt(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(path.Ext(u.Path), ".pdf")
+}
+
+// IsPDFContentType returns whether a Content-Type header value is a PDF.
+func IsPDFContentType(value string) bool {
+	t, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+	return t == "application/pdf" || t == "application/x-pdf"
+}
+
+// Classify returns the links on the page at pageURL which point to PDFs,
+// along with a Classification for every link considered.
+func (c *Classifier) Classify(ctx context.Context, pageURL string, links []Link) ([]Link, []Classification) {
+	var host string
+	if page, err := url.Parse(pageURL); err == nil {
+		host = strings.ToLower(page.Host)
+	}
+	var pdfs []Link
+	var report []Classification
+	for _, link := range links {
+		class := c.classify(ctx, host, link)
+		if class.PDF {
+			pdfs = append(pdfs, link)
+		}
+		report = append(report, class)
+	}
+	return pdfs, report
+}
+
+// classify returns the Classification of a single link on a page on `host`.
+func (c *Classifier) classify(ctx context.Context, host string, link Link) Classification {
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		return Classification{Link: link, Reason: "invalid URL"}
+	}
+	ext := path.Ext(u.Path)
+	if strings.EqualFold(ext, ".pdf") {
+		return Classification{Link: link, PDF: true, Reason: "extension " + ext}
+	}
+	if ext != "" {
+		return Classification{Link: link, Reason: "extension " + ext}
+	}
+	if c.Fetcher == nil {
+		return Classification{Link: link, Reason: "no extension"}
+	}
+	if strings.ToLower(u.Host) != host {
+		return Classification{Link: link, Reason: "no extension, on another site"}
+	}
+	req, err := http.NewRequest("HEAD", link.URL, nil)
+	if err != nil {
+		return Classification{Link: link, Reason: err.Error()}
+	}
+	resp, err := c.Fetcher.Do(ctx, req)
+	if err != nil {
+		return Classification{Link: link, Reason: "HEAD failed: " + err.Error()}
+	}
+	resp.Body.Close()
+	contentType := resp.Header.Get("Content-Type")
+	return Classification{
+		Link:   link,
+		PDF:    IsPDFContentType(contentType),
+		Reason: "Content-Type " + contentType,
+	}
+}
+
+// PDFName returns the name to save the PDF at rawurl under: its file name
+// with a lower case .pdf extension, which later stages of the pipeline
+// expect. A URL whose file name has no .pdf extension, e.g. a download
+// endpoint such as "/download?id=2", may share its file name with other
+// PDFs, so the name is made unique with a short hash of the whole URL,
+// including the query. A URL with no file name is named after its host.
+func PDFName(rawurl string) string {
+	name := FileName(rawurl)
+	if ext := path.Ext(name); strings.EqualFold(ext, ".pdf") && name != ext {
+		return strings.TrimSuffix(name, ext) + ".pdf"
+	}
+	if name == "" {
+		if u, err := url.Parse(rawurl); err == nil && u.Host != "" {
+			name = strings.ToLower(u.Hostname())
+		} else {
+			name = "file"
+		}
+	}
+	sum := sha256.Sum256([]byte(rawurl))
+	return name + "-" + hex.EncodeToString(sum[:4]) + ".pdf"
+}
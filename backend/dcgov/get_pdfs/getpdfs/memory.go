@@ -0,0 +1,75 @@
+package getpdfs
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryDB is a DB that keeps all data in memory, for tests and local runs.
+type MemoryDB struct {
+	mu sync.Mutex
+	// Files maps file names to their processing status.
+	Files map[string]FileStatus
+	// Pages maps URLs to their last seen state.
+	Pages map[string]PageState
+}
+
+// NewMemoryDB returns an empty MemoryDB.
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		Files: make(map[string]FileStatus),
+		Pages: make(map[string]PageState),
+	}
+}
+
+// GetFileStatus returns the processing status of a file.
+func (db *MemoryDB) GetFileStatus(ctx context.Context, file string) (FileStatus, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	status, ok := db.Files[file]
+	return status, ok, nil
+}
+
+// SetFileStatus records the processing status of a file.
+func (db *MemoryDB) SetFileStatus(ctx context.Context, file string, status FileStatus) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.Files[file] = status
+	return nil
+}
+
+// ListFiles returns the status of each file in one of the given states.
+func (db *MemoryDB) ListFiles(ctx context.Context, states ...string) (map[string]FileStatus, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	files := make(map[string]FileStatus)
+	for name, status := range db.Files {
+		for _, state := range states {
+			if status.State == state {
+				files[name] = status
+			}
+		}
+		if len(states) == 0 {
+			files[name] = status
+		}
+	}
+	return files, nil
+}
+
+// PageState returns the last seen state of the page at url.
+func (db *MemoryDB) PageState(ctx context.Context, url string) (PageState, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if state, ok := db.Pages[url]; ok {
+		return state, nil
+	}
+	return PageState{URL: url}, nil
+}
+
+// SetPageState records the last seen state of a page.
+func (db *MemoryDB) SetPageState(ctx context.Context, state PageState) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.Pages[state.URL] = state
+	return nil
+}
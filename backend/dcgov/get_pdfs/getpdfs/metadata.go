@@ -0,0 +1,185 @@
+package getpdfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var months = map[string]string{
+	"jan": "01",
+	"feb": "02",
+	"mar": "03",
+	"apr": "04",
+	"may": "05",
+	"jun": "06",
+	"jul": "07",
+	"aug": "08",
+	"sep": "09",
+	"oct": "10",
+	"nov": "11",
+	"dec": "12",
+}
+
+var monthYearRe = regexp.MustCompile(`(?i)(?:^|[^a-z])(jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\.?[\s,_-]*(\d{4})(?:[^0-9]|$)`)
+
+// MonthYear returns the first month and year, e.g. "July 2019", in s as
+// "2019-07", or an empty string if there is none.
+func MonthYear(s string) string {
+	m := monthYearRe.FindStringSubmatch(s)
+	if m == nil {
+		return ""
+	}
+	return m[2] + "-" + months[strings.ToLower(m[1][0:3])]
+}
+
+var (
+	pdfTitleRe = regexp.MustCompile(`/Title\s*(\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f\s]*>)`)
+	xmpTitleRe = regexp.MustCompile(`(?s)<dc:title>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+	hexRe      = regexp.MustCompile(`[^0-9A-Fa-f]`)
+)
+
+// PDFTitle returns the title of a PDF from its document information
+// dictionary or XMP metadata, or an empty string if it has none. It only
+// finds titles stored outside compressed object streams.
+func PDFTitle(data []byte) string {
+	if m := pdfTitleRe.FindSubmatch(data); m != nil {
+		var b []byte
+		if m[1][0] == '(' {
+			b = unescapePDFString(m[1][1 : len(m[1])-1])
+		} else {
+			b = decodeHex(hexRe.ReplaceAll(m[1], nil))
+		}
+		if title := normalizeSpace(decodePDFText(b)); title != "" {
+			return title
+		}
+	}
+	if m := xmpTitleRe.FindSubmatch(data); m != nil {
+		return normalizeSpace(string(m[1]))
+	}
+	return ""
+}
+
+// unescapePDFString returns the bytes of a PDF literal string, without its
+// enclosing parentheses.
+func unescapePDFString(s []byte) []byte {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case '\r', '\n':
+			// A line continuation.
+		default:
+			if c >= '0' && c <= '7' {
+				n := 0
+				for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+					n = n*8 + int(s[i]-'0')
+					i++
+				}
+				i--
+				b.WriteByte(byte(n))
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// decodeHex returns the bytes of a PDF hex string. A missing final digit
+// is taken to be zero.
+func decodeHex(h []byte) []byte {
+	if len(h)%2 == 1 {
+		h = append(h, '0')
+	}
+	b := make([]byte, len(h)/2)
+	for i := range b {
+		b[i] = unhex(h[2*i])<<4 | unhex(h[2*i+1])
+	}
+	return b
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0
+}
+
+// decodePDFText returns a PDF text string as UTF-8. Strings starting with a
+// byte order mark are UTF-16BE; others are treated as Latin-1, which matches
+// PDFDocEncoding for printable characters.
+func decodePDFText(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		var u []uint16
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// FileMetadata returns the metadata to save with the PDF at link: where it
+// came from, its SHA-256 hash and size, any text which may describe it, and
+// the month and year it covers, if found, as "month" in the form "2006-01".
+func FileMetadata(link Link, data []byte) map[string]string {
+	sum := sha256.Sum256(data)
+	meta := map[string]string{
+		"sourceUrl": link.URL,
+		"sha256":    hex.EncodeToString(sum[:]),
+		"size":      strconv.Itoa(len(data)),
+	}
+	sources := []struct {
+		key   string
+		value string
+	}{
+		{"linkText", link.Text},
+		{"linkTitle", link.Title},
+		{"linkLabel", link.Label},
+		{"linkHeading", link.Heading},
+		{"pdfTitle", PDFTitle(data)},
+	}
+	for _, src := range sources {
+		if src.value == "" {
+			continue
+		}
+		meta[src.key] = src.value
+		if _, ok := meta["month"]; ok {
+			continue
+		}
+		if month := MonthYear(src.value); month != "" {
+			meta["month"] = month
+			meta["monthSource"] = src.key
+		}
+	}
+	return meta
+}
@@ -0,0 +1,155 @@
+package getpdfs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// sqliteMigrations are the changes made to the schema of a SQLiteDB, in
+// order, as for the SQLite database of the loader. A database's
+// user_version is the number of them applied to it. To change the schema,
+// add a migration rather than editing an earlier one.
+var sqliteMigrations = [][]string{
+	{
+		`CREATE TABLE IF NOT EXISTS dc_gov_files (
+			name TEXT PRIMARY KEY,
+			state TEXT NOT NULL,
+			status TEXT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS dc_gov_pages (
+			url TEXT PRIMARY KEY,
+			state TEXT NOT NULL
+		)`,
+	},
+}
+
+// SQLiteDB is a DB backed by a SQLite database, for running without
+// Firebase. File statuses and page states are stored as JSON. It uses
+// database/sql, so the program must register a SQLite driver, e.g. by
+// importing github.com/mattn/go-sqlite3.
+type SQLiteDB struct {
+	db *sql.DB
+}
+
+// NewSQLiteDB returns a DB using the given SQLite database, creating its
+// tables or upgrading them if they are out of date.
+func NewSQLiteDB(ctx context.Context, db *sql.DB) (*SQLiteDB, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return nil, err
+	}
+	if version > len(sqliteMigrations) {
+		return nil, fmt.Errorf("SQLite database is version %d, newer than the latest known version %d",
+			version, len(sqliteMigrations))
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, migration := range sqliteMigrations[version:] {
+		for _, stmt := range migration {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// PRAGMA does not accept parameters.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, len(sqliteMigrations))); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &SQLiteDB{db: db}, nil
+}
+
+// GetFileStatus returns the processing status of a file.
+func (db *SQLiteDB) GetFileStatus(ctx context.Context, file string) (FileStatus, bool, error) {
+	var data string
+	err := db.db.QueryRowContext(ctx, `SELECT status FROM dc_gov_files WHERE name = ?`, file).Scan(&data)
+	if err == sql.ErrNoRows {
+		return FileStatus{}, false, nil
+	}
+	if err != nil {
+		return FileStatus{}, false, err
+	}
+	var status FileStatus
+	if err := json.Unmarshal([]byte(data), &status); err != nil {
+		return FileStatus{}, false, err
+	}
+	return status, true, nil
+}
+
+// SetFileStatus records the processing status of a file.
+func (db *SQLiteDB) SetFileStatus(ctx context.Context, file string, status FileStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO dc_gov_files (name, state, status) VALUES (?, ?, ?)`,
+		file, status.State, string(data))
+	return err
+}
+
+// ListFiles returns the status of each file in one of the given states.
+func (db *SQLiteDB) ListFiles(ctx context.Context, states ...string) (map[string]FileStatus, error) {
+	query := `SELECT name, status FROM dc_gov_files`
+	var args []interface{}
+	if len(states) > 0 {
+		query += ` WHERE state IN (?` + strings.Repeat(`, ?`, len(states)-1) + `)`
+		for _, state := range states {
+			args = append(args, state)
+		}
+	}
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := make(map[string]FileStatus)
+	for rows.Next() {
+		var name, data string
+		if err := rows.Scan(&name, &data); err != nil {
+			return nil, err
+		}
+		var status FileStatus
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			return nil, err
+		}
+		files[name] = status
+	}
+	return files, rows.Err()
+}
+
+// PageState returns the last seen state of the page at url.
+func (db *SQLiteDB) PageState(ctx context.Context, url string) (PageState, error) {
+	var data string
+	err := db.db.QueryRowContext(ctx, `SELECT state FROM dc_gov_pages WHERE url = ?`, url).Scan(&data)
+	if err == sql.ErrNoRows {
+		return PageState{URL: url}, nil
+	}
+	if err != nil {
+		return PageState{}, err
+	}
+	var state PageState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return PageState{}, err
+	}
+	return state, nil
+}
+
+// SetPageState records the last seen state of a page.
+func (db *SQLiteDB) SetPageState(ctx context.Context, state PageState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO dc_gov_pages (url, state) VALUES (?, ?)`, state.URL, string(data))
+	return err
+}
@@ -0,0 +1,220 @@
+package getpdfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"foodtrucks/dcgov/blob"
+)
+
+// The states of a file in the dcGovFiles collection.
+const (
+	// FileProcessing means the file was fetched and is being converted and
+	// loaded.
+	FileProcessing = "processing"
+	// FileOK means the file was loaded.
+	FileOK = "ok"
+	// FileRetry means the file failed and will be fetched again after
+	// NextAttempt.
+	FileRetry = "retry"
+	// FileDead means the file failed MaxAttempts times and will not be
+	// retried until a maintainer requeues it.
+	FileDead = "dead"
+)
+
+// The stages at which processing a file can fail.
+const (
+	StageFetch   = "fetch"
+	StageConvert = "convert"
+	StageLoad    = "load"
+)
+
+// The retry policy for failed files. It must match the one in load_db and
+// convert_pdf, which TestRetryPolicyMatches in load_db checks.
+const (
+	// MaxAttempts is the number of times a file may fail before it is
+	// dead-lettered.
+	MaxAttempts = 5
+	// RetryBase is the time to wait before retrying a file after its first
+	// failure. It doubles with each failure, up to RetryMax.
+	RetryBase = time.Hour
+	// RetryMax is the longest time to wait before retrying a file.
+	RetryMax = 24 * time.Hour
+	// ProcessingTimeout is how long a file may be processing before it is
+	// taken to have failed without recording why, e.g. because the convert
+	// function crashed.
+	ProcessingTimeout = time.Hour
+)
+
+// FileStatus is the processing status of a file, kept in the dcGovFiles
+// collection. The same document is updated by the fetch, convert and load
+// stages.
+type FileStatus struct {
+	OK    bool   `firestore:"ok"`
+	State string `firestore:"state"`
+	// Attempts is the number of failed attempts since the file was last
+	// requeued.
+	Attempts int `firestore:"attempts"`
+	// Stage and LastError describe the last failure.
+	Stage        string    `firestore:"stage"`
+	LastError    string    `firestore:"lastError"`
+	FirstAttempt time.Time `firestore:"firstAttempt"`
+	LastAttempt  time.Time `firestore:"lastAttempt"`
+	// NextAttempt is when a file in the FileRetry state is retried.
+	NextAttempt time.Time `firestore:"nextAttempt"`
+	// SourceURL is the URL the file was fetched from.
+	SourceURL string `firestore:"sourceUrl"`
+}
+
+// retryDelay returns how long to wait before retrying a file which has
+// failed `attempts` times.
+func retryDelay(attempts int) time.Duration {
+	d := RetryBase
+	for i := 1; i < attempts && d < RetryMax; i++ {
+		d *= 2
+	}
+	if d > RetryMax {
+		d = RetryMax
+	}
+	return d
+}
+
+// Fetched returns the status after the file was fetched at `now` and is to
+// be converted and loaded.
+func (s FileStatus) Fetched(now time.Time) FileStatus {
+	if s.FirstAttempt.IsZero() {
+		s.FirstAttempt = now
+	}
+	s.OK = false
+	s.State = FileProcessing
+	s.LastAttempt = now
+	s.NextAttempt = time.Time{}
+	return s
+}
+
+// Failed returns the status after an attempt which failed at `stage` at
+// `now`. The file is retried after an exponentially increasing delay, or
+// is dead-lettered once it has failed MaxAttempts times.
+func (s FileStatus) Failed(stage string, err error, now time.Time) FileStatus {
+	if s.FirstAttempt.IsZero() {
+		s.FirstAttempt = now
+	}
+	s.OK = false
+	s.Attempts++
+	s.Stage = stage
+	s.LastError = err.Error()
+	s.LastAttempt = now
+	if s.Attempts >= MaxAttempts {
+		s.State = FileDead
+		s.NextAttempt = time.Time{}
+	} else {
+		s.State = FileRetry
+		s.NextAttempt = now.Add(retryDelay(s.Attempts))
+	}
+	return s
+}
+
+// Requeue returns the status of a file to be retried at `now` with a fresh
+// set of attempts, e.g. after a maintainer has fixed the cause of its
+// failures.
+func (s FileStatus) Requeue(now time.Time) FileStatus {
+	s.OK = false
+	s.State = FileRetry
+	s.Attempts = 0
+	s.NextAttempt = now
+	return s
+}
+
+// AlreadyProcessed returns whether a file with the given name, not including
+// file extension, has been fetched. Files which failed are fetched again by
+// RetryFiles once their retry is due; files which failed before their
+// status was recorded in detail are fetched again now.
+func AlreadyProcessed(name string, db DB) (bool, error) {
+	ctx := context.Background()
+	fileNoExt := strings.TrimSuffix(name, path.Ext(name))
+	s, ok, err := db.GetFileStatus(ctx, fileNoExt)
+	if err != nil || !ok {
+		return false, err
+	}
+	return s.OK || s.State != "", nil
+}
+
+// refetch saves a file to the bucket again, which starts its conversion and
+// load again. The PDF is taken from the bucket if it is there, or fetched
+// from its source URL.
+func refetch(ctx context.Context, fetcher *Fetcher, name string, s FileStatus, bucket blob.Store) error {
+	attrs, err := bucket.Stat(ctx, name)
+	if err == nil {
+		data, err := bucket.Get(ctx, name)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(ctx, name, bytes.NewReader(data), attrs.Metadata)
+	}
+	if err != blob.ErrNotExist {
+		return err
+	}
+	if s.SourceURL == "" {
+		return errors.New("No source URL to fetch " + name + " from")
+	}
+	resp, err := fetcher.Get(ctx, s.SourceURL)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	return bucket.Put(ctx, name, bytes.NewReader(data), FileMetadata(Link{URL: s.SourceURL}, data))
+}
+
+// RetryFiles fetches again the files whose retry is due at `now`. Files
+// which have been processing for longer than ProcessingTimeout are marked
+// failed, to be retried later.
+func RetryFiles(ctx context.Context, fetcher *Fetcher, bucket blob.Store, db DB, now time.Time) error {
+	files, err := db.ListFiles(ctx, FileRetry, FileProcessing)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := files[name]
+		if s.State == FileProcessing {
+			if now.Sub(s.LastAttempt) < ProcessingTimeout {
+				continue
+			}
+			err := fmt.Errorf("No result %s after fetching; conversion or load did not finish", ProcessingTimeout)
+			if err := db.SetFileStatus(ctx, name, s.Failed(StageConvert, err, now)); err != nil {
+				return err
+			}
+			continue
+		}
+		if now.Before(s.NextAttempt) {
+			continue
+		}
+		log.Printf("Retrying %s after %d failed attempts", name, s.Attempts)
+		if err := refetch(ctx, fetcher, name+".pdf", s, bucket); err != nil {
+			log.Printf("Retrying %s failed: %v", name, err)
+			s = s.Failed(StageFetch, err, now)
+		} else {
+			s = s.Fetched(now)
+		}
+		if err := db.SetFileStatus(ctx, name, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
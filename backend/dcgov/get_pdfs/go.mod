@@ -4,5 +4,11 @@ go 1.12
 
 require (
 	cloud.google.com/go v0.40.0
+	foodtrucks/dcgov/blob v0.0.0
+	github.com/mattn/go-sqlite3 v1.14.6
 	golang.org/x/net v0.0.0-20190613194153-d28f0bde5980
+	google.golang.org/api v0.6.0
+	google.golang.org/grpc v1.20.1
 )
+
+replace foodtrucks/dcgov/blob => ../blob
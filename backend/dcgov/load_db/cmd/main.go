@@ -1,17 +1,71 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
 	"log"
 
+	"foodtrucks/dcgov/blob"
 	"foodtrucks/dcgov/loaddb"
+
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
-	file := "Apr 2017 - MRV Lottery Results.csv"
-	bucket := "davidkretch-test"
+	dir := flag.String("dir", "", "read CSVs from this local directory instead of the bucket, and load them into memory instead of Firestore")
+	sqlitePath := flag.String("sqlite", "", "load into this SQLite database file instead of Firestore, or memory if -dir is set")
+	rollback := flag.Bool("rollback", false, "roll back an unfinished load of the file instead of loading it")
+	file := flag.String("file", "Apr 2017 - MRV Lottery Results.csv", "name of the CSV to load")
+	flag.Parse()
+
+	ctx := context.Background()
 	project := "serene-foundry-234813"
-	err := loaddb.LoadDB(file, bucket, project)
-	if err != nil {
-		log.Fatalf("Error processing file %s: %s", file, err)
+
+	var bucket blob.Store
+	if *dir != "" {
+		bucket = blob.NewDir(*dir)
+	} else {
+		gcs, err := blob.NewGCS(ctx, "davidkretch-test")
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		defer gcs.Close()
+		bucket = gcs
+	}
+
+	var db loaddb.DB
+	switch {
+	case *sqlitePath != "":
+		conn, err := sql.Open("sqlite3", *sqlitePath)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		defer conn.Close()
+		sqlite, err := loaddb.NewSQLiteDB(ctx, conn)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		db = sqlite
+	case *dir != "":
+		db = loaddb.NewMemoryDB()
+	default:
+		fs, err := loaddb.NewFirestoreDB(ctx, project)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		defer fs.Close()
+		db = fs
+	}
+
+	if *rollback {
+		if err := loaddb.RollbackLoad(*file, db); err != nil {
+			log.Fatalf("Error rolling back file %s: %s", *file, err)
+		}
+		return
+	}
+
+	if err := loaddb.LoadDB(*file, bucket, db); err != nil {
+		log.Fatalf("Error processing file %s: %s", *file, err)
 	}
 }
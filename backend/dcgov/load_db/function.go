@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 
+	"foodtrucks/dcgov/blob"
 	"foodtrucks/dcgov/loaddb"
 )
 
@@ -20,7 +21,17 @@ type GCSEvent struct {
 func LoadDB(ctx context.Context, e GCSEvent) error {
 	log.Printf("Processing file: %s", e.Name)
 	project := os.Getenv("PROJECT")
-	err := loaddb.LoadDB(e.Name, e.Bucket, project)
+	bucket, err := blob.NewGCS(ctx, e.Bucket)
+	if err != nil {
+		return err
+	}
+	defer bucket.Close()
+	db, err := loaddb.NewFirestoreDB(ctx, project)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	err = loaddb.LoadDB(e.Name, bucket, db)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,115 @@
+package loaddb
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"cloud.google.com/go/firestore"
+)
+
+// MaxBatchWrites is the most writes Firestore allows in one batch.
+const MaxBatchWrites = 500
+
+// writeBatch is the part of a firestore.WriteBatch used by BatchWriter.
+type writeBatch interface {
+	Set(ref *firestore.DocumentRef, data interface{}, opts ...firestore.SetOption)
+	Delete(ref *firestore.DocumentRef)
+	Commit(ctx context.Context) error
+}
+
+// firestoreBatch is a writeBatch backed by Firestore.
+type firestoreBatch struct {
+	batch *firestore.WriteBatch
+}
+
+func (b firestoreBatch) Set(ref *firestore.DocumentRef, data interface{}, opts ...firestore.SetOption) {
+	b.batch.Set(ref, data, opts...)
+}
+
+func (b firestoreBatch) Delete(ref *firestore.DocumentRef) {
+	b.batch.Delete(ref)
+}
+
+func (b firestoreBatch) Commit(ctx context.Context) error {
+	_, err := b.batch.Commit(ctx)
+	return err
+}
+
+// A BatchWriter splits writes into batches of at most MaxBatchWrites,
+// committing each when it is full. A load which fails part way is not
+// resumed but rolled back using its manifest, so the writes committed
+// before a failure are only reported.
+type BatchWriter struct {
+	newBatch  func() writeBatch
+	batch     writeBatch
+	size      int
+	committed int
+	// Progress, if set, is called with the number of writes committed so
+	// far after each batch. By default progress is logged.
+	Progress func(committed int)
+}
+
+// NewBatchWriter returns a BatchWriter for the given client.
+func NewBatchWriter(client *firestore.Client) *BatchWriter {
+	newBatch := func() writeBatch {
+		return firestoreBatch{batch: client.Batch()}
+	}
+	return &BatchWriter{newBatch: newBatch, batch: newBatch()}
+}
+
+// Reserve commits the current batch if it does not have room for n more
+// writes, so that writes which must be made together, e.g. a truck and its
+// name, are in the same batch.
+func (w *BatchWriter) Reserve(ctx context.Context, n int) error {
+	if w.size+n > MaxBatchWrites {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// add adds a write to the batch, first committing the batch if it is full.
+func (w *BatchWriter) add(ctx context.Context, write func()) error {
+	if w.size == MaxBatchWrites {
+		if err := w.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	write()
+	w.size++
+	return nil
+}
+
+// Set adds a write setting a document.
+func (w *BatchWriter) Set(ctx context.Context, ref *firestore.DocumentRef, data interface{}, opts ...firestore.SetOption) error {
+	return w.add(ctx, func() { w.batch.Set(ref, data, opts...) })
+}
+
+// Delete adds a write deleting a document.
+func (w *BatchWriter) Delete(ctx context.Context, ref *firestore.DocumentRef) error {
+	return w.add(ctx, func() { w.batch.Delete(ref) })
+}
+
+// Flush commits the writes in the current batch, if any.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	if w.size == 0 {
+		return nil
+	}
+	if err := w.batch.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed after committing %d writes: %v", w.committed, err)
+	}
+	w.committed += w.size
+	w.batch = w.newBatch()
+	w.size = 0
+	if w.Progress != nil {
+		w.Progress(w.committed)
+	} else {
+		log.Printf("Committed %d writes", w.committed)
+	}
+	return nil
+}
+
+// Committed returns the number of writes committed so far.
+func (w *BatchWriter) Committed() int {
+	return w.committed
+}
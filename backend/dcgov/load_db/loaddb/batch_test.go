@@ -0,0 +1,92 @@
+package loaddb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+)
+
+// fakeBatch is a writeBatch which counts writes, failing to commit once
+// `fail` batches have been committed.
+type fakeBatch struct {
+	writes  int
+	commits *[]int
+	fail    int
+}
+
+func (b *fakeBatch) Set(ref *firestore.DocumentRef, data interface{}, opts ...firestore.SetOption) {
+	b.writes++
+}
+
+func (b *fakeBatch) Delete(ref *firestore.DocumentRef) {
+	b.writes++
+}
+
+func (b *fakeBatch) Commit(ctx context.Context) error {
+	if len(*b.commits) == b.fail {
+		return errors.New("commit failed")
+	}
+	*b.commits = append(*b.commits, b.writes)
+	return nil
+}
+
+func testBatchWriter(commits *[]int, fail int) *BatchWriter {
+	newBatch := func() writeBatch {
+		return &fakeBatch{commits: commits, fail: fail}
+	}
+	return &BatchWriter{newBatch: newBatch, batch: newBatch(), Progress: func(int) {}}
+}
+
+func TestBatchWriter(t *testing.T) {
+	ctx := context.Background()
+	var commits []int
+	w := testBatchWriter(&commits, -1)
+	for i := 0; i < 1200; i++ {
+		if err := w.Set(ctx, nil, nil); err != nil {
+			t.Fatalf("Set returned error: %v", err)
+		}
+	}
+	if err := w.Flush(ctx); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+	if len(commits) != 3 || commits[0] != 500 || commits[1] != 500 || commits[2] != 200 {
+		t.Fatalf("BatchWriter committed batches of %v, want [500 500 200]", commits)
+	}
+	if w.Committed() != 1200 {
+		t.Fatalf("Committed returned %d, want 1200", w.Committed())
+	}
+
+	// Writes reserved together are committed together.
+	commits = nil
+	w = testBatchWriter(&commits, -1)
+	for i := 0; i < 300; i++ {
+		w.Reserve(ctx, 2)
+		w.Set(ctx, nil, nil)
+		w.Delete(ctx, nil)
+	}
+	w.Set(ctx, nil, nil)
+	w.Reserve(ctx, 2)
+	w.Flush(ctx)
+	if len(commits) != 2 || commits[0] != 500 || commits[1] != 101 {
+		t.Fatalf("BatchWriter committed batches of %v, want [500 101]", commits)
+	}
+}
+
+func TestBatchWriterError(t *testing.T) {
+	ctx := context.Background()
+	var commits []int
+	w := testBatchWriter(&commits, 1)
+	var err error
+	for i := 0; i < 1200 && err == nil; i++ {
+		err = w.Set(ctx, nil, nil)
+	}
+	if err == nil || !strings.Contains(err.Error(), "after committing 500 writes") {
+		t.Fatalf("BatchWriter returned %v, want an error after 500 writes", err)
+	}
+	if len(commits) != 1 || w.Committed() != 500 {
+		t.Fatalf("BatchWriter committed batches of %v, want [500]", commits)
+	}
+}
@@ -0,0 +1,145 @@
+package loaddb
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The kinds of stop cell.
+const (
+	// CellOff is a cell for a day the truck has no stop.
+	CellOff = "off"
+	// CellUnknown is a cell for a day the truck has a stop which is not
+	// known yet.
+	CellUnknown = "unknown"
+	// CellStops is a cell listing one or more stops.
+	CellStops = "stops"
+)
+
+// offWords are the cells, ignoring case, spacing and trailing full stops,
+// which mean a truck has no stop that day.
+var offWords = map[string]bool{
+	"":     true,
+	"off":  true,
+	"n/a":  true,
+	"na":   true,
+	"none": true,
+	"-":    true,
+	"–":    true,
+	"—":    true,
+}
+
+// unknownWords are the cells, ignoring case, spacing and trailing full
+// stops, which mean a truck's stop that day is not known yet.
+var unknownWords = map[string]bool{
+	"tbd":     true,
+	"tba":     true,
+	"?":       true,
+	"unknown": true,
+}
+
+// stopSeparatorRe matches the separators between stops in a cell. A "/" or
+// "+" only separates stops with whitespace on both sides, since without it
+// it joins the streets of an intersection, e.g. "14th St/K St NW".
+var stopSeparatorRe = regexp.MustCompile(`\s*[;|\n]\s*|\s+[/+]\s+`)
+
+// footnoteRe matches footnote markers at either end of a stop, e.g. the
+// "*" of "Franklin Sq*".
+var footnoteRe = regexp.MustCompile(`^[*†‡§#^]+|[*†‡§#^]+$`)
+
+// remarkRe matches a remark in brackets, e.g. "(lunch only)".
+var remarkRe = regexp.MustCompile(`\s*[(\[]([^)\]]*)[)\]]`)
+
+// A CellStop is a stop listed in a cell, with its time window, if any, as
+// returned by ParseTimeWindow, and any annotations removed from its name.
+type CellStop struct {
+	Name  string
+	Start string
+	End   string
+	Notes []string
+}
+
+// A StopCell is a parsed stop cell.
+type StopCell struct {
+	// Kind is CellOff, CellUnknown or CellStops.
+	Kind string
+	// Stops are the stops listed, if Kind is CellStops.
+	Stops []CellStop
+}
+
+// cellWord returns a cell in the form used to look it up in offWords and
+// unknownWords.
+func cellWord(s string) string {
+	s = footnoteRe.ReplaceAllString(strings.TrimSpace(s), "")
+	return strings.ToLower(strings.TrimRight(strings.TrimSpace(s), "."))
+}
+
+// parseStop parses one stop of a cell. It returns false if the stop has no
+// name once its annotations are removed.
+func parseStop(s string) (CellStop, bool) {
+	var stop CellStop
+	stripMarks := func(s string) string {
+		s = strings.TrimSpace(s)
+		stop.Notes = append(stop.Notes, footnoteRe.FindAllString(s, -1)...)
+		return strings.TrimSpace(footnoteRe.ReplaceAllString(s, ""))
+	}
+	// Markers may follow the time window, or come between it and the name.
+	s, stop.Start, stop.End = ParseTimeWindow(stripMarks(s))
+	for _, m := range remarkRe.FindAllStringSubmatch(s, -1) {
+		if note := strings.TrimSpace(m[1]); note != "" {
+			stop.Notes = append(stop.Notes, note)
+		}
+	}
+	s = stripMarks(remarkRe.ReplaceAllString(s, ""))
+	stop.Name = strings.Join(strings.Fields(s), " ")
+	return stop, stop.Name != ""
+}
+
+// ParseStopCell parses a cell of the lottery results giving a truck's stop
+// for a day. The grammar, ignoring case and spacing, is:
+//
+//	cell    = off | unknown | stops
+//	off     = "" | "OFF" | "N/A" | "NA" | "None" | "-"
+//	unknown = "TBD" | "TBA" | "Unknown" | "?"
+//	stops   = stop { ( ";" | " / " | " + " | "|" | newline ) stop }
+//	stop    = [marks] name [marks] [remark] [window] [marks]
+//	marks   = footnote markers: "*", "†", "‡", "§", "#" or "^"
+//	remark  = text in brackets, e.g. "(lunch only)"
+//	window  = a time window, as parsed by ParseTimeWindow
+//
+// Off and unknown words may have footnote markers and a trailing full stop.
+// Footnote markers and remarks are moved from a stop's name to its Notes.
+// Parts of a cell listing several stops which are off or unknown words are
+// ignored, and a cell with no stops left is off, or unknown if any part was
+// unknown.
+func ParseStopCell(cell string) StopCell {
+	word := cellWord(cell)
+	if offWords[word] {
+		return StopCell{Kind: CellOff}
+	}
+	if unknownWords[word] {
+		return StopCell{Kind: CellUnknown}
+	}
+	var stops []CellStop
+	unknown := false
+	for _, part := range stopSeparatorRe.Split(strings.TrimSpace(cell), -1) {
+		word := cellWord(part)
+		if offWords[word] {
+			continue
+		}
+		if unknownWords[word] {
+			unknown = true
+			continue
+		}
+		if stop, ok := parseStop(part); ok {
+			stops = append(stops, stop)
+		}
+	}
+	switch {
+	case len(stops) > 0:
+		return StopCell{Kind: CellStops, Stops: stops}
+	case unknown:
+		return StopCell{Kind: CellUnknown}
+	}
+	return StopCell{Kind: CellOff}
+}
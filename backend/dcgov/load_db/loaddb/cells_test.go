@@ -0,0 +1,73 @@
+package loaddb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseStopCell(t *testing.T) {
+	tests := []struct {
+		cell string
+		want StopCell
+	}{
+		{"", StopCell{Kind: CellOff}},
+		{"OFF", StopCell{Kind: CellOff}},
+		{"off ", StopCell{Kind: CellOff}},
+		{"Off.", StopCell{Kind: CellOff}},
+		{"N/A", StopCell{Kind: CellOff}},
+		{" - ", StopCell{Kind: CellOff}},
+		{"OFF*", StopCell{Kind: CellOff}},
+		{"TBD", StopCell{Kind: CellUnknown}},
+		{"tba", StopCell{Kind: CellUnknown}},
+		{"Farragut Square", StopCell{Kind: CellStops, Stops: []CellStop{{Name: "Farragut Square"}}}},
+		{"Franklin Sq*", StopCell{Kind: CellStops, Stops: []CellStop{{Name: "Franklin Sq", Notes: []string{"*"}}}}},
+		{"Franklin  Sq (lunch only)", StopCell{Kind: CellStops, Stops: []CellStop{{Name: "Franklin Sq", Notes: []string{"lunch only"}}}}},
+		{"Franklin Sq* (11am-2pm)", StopCell{Kind: CellStops, Stops: []CellStop{
+			{Name: "Franklin Sq", Start: "11:00", End: "14:00", Notes: []string{"*"}},
+		}}},
+		{"Farragut Sq / Franklin Sq", StopCell{Kind: CellStops, Stops: []CellStop{{Name: "Farragut Sq"}, {Name: "Franklin Sq"}}}},
+		{"14th St/K St NW", StopCell{Kind: CellStops, Stops: []CellStop{{Name: "14th St/K St NW"}}}},
+		{"14th St+K St NW; Franklin Sq", StopCell{Kind: CellStops, Stops: []CellStop{{Name: "14th St+K St NW"}, {Name: "Franklin Sq"}}}},
+		{"Navy Yard 11am-2pm; Union Station 5-9pm", StopCell{Kind: CellStops, Stops: []CellStop{
+			{Name: "Navy Yard", Start: "11:00", End: "14:00"},
+			{Name: "Union Station", Start: "17:00", End: "21:00"},
+		}}},
+		{"Navy Yard\nTBD", StopCell{Kind: CellStops, Stops: []CellStop{{Name: "Navy Yard"}}}},
+		{"TBD / OFF", StopCell{Kind: CellUnknown}},
+		{"- / OFF", StopCell{Kind: CellOff}},
+	}
+	for _, test := range tests {
+		if got := ParseStopCell(test.cell); fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", test.want) {
+			t.Errorf("ParseStopCell(%q) = %+v, want %+v", test.cell, got, test.want)
+		}
+	}
+}
+
+func TestProcessStopCells(t *testing.T) {
+	data := Records{
+		{"Business Name": "Foo", "Monday": "Off", "Tuesday": "TBD", "Wednesday": "N/A",
+			"Thursday": "Franklin Sq*", "Friday": "A / B"},
+	}
+	// July 1, 2019 was a Monday.
+	start := time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, time.July, 5, 0, 0, 0, 0, time.UTC)
+	schedule, err := Process(data, nil, start, end, nil)
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+	for _, date := range []string{"2019-07-01", "2019-07-02", "2019-07-03"} {
+		if len(schedule.Days[date]) != 0 {
+			t.Fatalf("Process scheduled a stop on %s: %v", date, schedule.Days[date])
+		}
+	}
+	if a := schedule.Days["2019-07-04"]["Franklin Sq"]; len(a) != 1 || a[0].Notes != "*" {
+		t.Fatalf("Process returned wrong schedule for a footnoted stop: %v", schedule.Days["2019-07-04"])
+	}
+	if day := schedule.Days["2019-07-05"]; len(day["A"]) != 1 || len(day["B"]) != 1 {
+		t.Fatalf("Process returned wrong schedule for two stops: %v", day)
+	}
+	if len(schedule.Stops) != 3 {
+		t.Fatalf("Process returned wrong stops: %v", schedule.Stops)
+	}
+}
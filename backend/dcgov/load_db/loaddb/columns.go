@@ -0,0 +1,178 @@
+package loaddb
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"foodtrucks/dcgov/blob"
+)
+
+// ColumnsFile is the name of the object in the bucket which lists more
+// column names for the fields of the lottery results, as a JSON object in
+// the form of ColumnAliases, e.g. {"Business Name": ["Vendor"]}. They are
+// added to DefaultColumnAliases.
+const ColumnsFile = "columns.json"
+
+// FieldTruck is the field holding the name of a truck. The other fields are
+// the days of the week, named as by time.Weekday.
+const FieldTruck = "Business Name"
+
+// ColumnAliases maps each field to other names for its column. Column names
+// are matched ignoring case, whitespace and punctuation, so "MONDAY " and
+// "Thurs." need no aliases beyond "Monday" and "Thurs".
+type ColumnAliases = map[string][]string
+
+// DefaultColumnAliases are the column names seen in the lottery results.
+var DefaultColumnAliases = ColumnAliases{
+	FieldTruck:  {"Vendor Name", "Vendor", "Business", "Truck Name", "Truck", "Company Name"},
+	"Monday":    {"Mon"},
+	"Tuesday":   {"Tue", "Tues"},
+	"Wednesday": {"Wed"},
+	"Thursday":  {"Thu", "Thur", "Thurs"},
+	"Friday":    {"Fri"},
+	"Saturday":  {"Sat"},
+	"Sunday":    {"Sun"},
+}
+
+// requiredFields are the fields every file must have. Saturday and Sunday
+// are optional.
+func requiredFields() []string {
+	fields := []string{FieldTruck}
+	for d := time.Monday; d <= time.Friday; d++ {
+		fields = append(fields, d.String())
+	}
+	return fields
+}
+
+// allFields returns the fields of the lottery results.
+func allFields() []string {
+	fields := []string{FieldTruck}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		fields = append(fields, d.String())
+	}
+	return fields
+}
+
+// isField returns whether `name` is a field of the lottery results.
+func isField(name string) bool {
+	for _, field := range allFields() {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// A ColumnMapping records which column of a file each field was taken from.
+type ColumnMapping struct {
+	// Fields maps each field found to the name of its column in the file.
+	Fields map[string]string
+	// Unmapped lists the columns which are not any field, sorted.
+	Unmapped []string
+}
+
+// Apply returns the records with their columns renamed to the fields they
+// map to, leaving out unmapped columns.
+func (m ColumnMapping) Apply(data Records) Records {
+	records := make(Records, 0, len(data))
+	for _, rec := range data {
+		mapped := make(map[string]string)
+		for field, column := range m.Fields {
+			mapped[field] = rec[column]
+		}
+		records = append(records, mapped)
+	}
+	return records
+}
+
+// Log logs which column each field was taken from, and the columns which
+// were not used, to show when the format of the files changes.
+func (m ColumnMapping) Log(file string) {
+	var fields []string
+	for field := range m.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if column := m.Fields[field]; column != field {
+			log.Printf("%s: column %q is %s", file, column, field)
+		}
+	}
+	for _, column := range m.Unmapped {
+		log.Printf("%s: ignoring column %q", file, column)
+	}
+}
+
+// MapColumns returns which column of `data` each field is in. A column
+// matches a field if its name, or one of its aliases, is the same as the
+// column's name ignoring case, whitespace and punctuation. If `aliases` is
+// nil, DefaultColumnAliases are used. The error is a *ValidationError if a
+// required field is missing, or more than one column matches a field.
+func MapColumns(data Records, aliases ColumnAliases) (ColumnMapping, error) {
+	if aliases == nil {
+		aliases = DefaultColumnAliases
+	}
+	if len(data) == 0 {
+		return ColumnMapping{}, ValidationReport{Errors: []Problem{{Message: "No rows"}}}.Err()
+	}
+	// A field's own name takes precedence over an alias of another field.
+	names := make(map[string]string)
+	for _, field := range allFields() {
+		names[KeyName(field)] = field
+	}
+	for _, field := range allFields() {
+		for _, name := range aliases[field] {
+			if _, ok := names[KeyName(name)]; !ok {
+				names[KeyName(name)] = field
+			}
+		}
+	}
+
+	var columns []string
+	for column := range data[0] {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	var report ValidationReport
+	m := ColumnMapping{Fields: make(map[string]string)}
+	for _, column := range columns {
+		field, ok := names[KeyName(column)]
+		if !ok {
+			m.Unmapped = append(m.Unmapped, column)
+			continue
+		}
+		if other, ok := m.Fields[field]; ok {
+			report.errorf(0, 0, "Columns %q and %q are both %s", other, column, field)
+			continue
+		}
+		m.Fields[field] = column
+	}
+	for _, field := range requiredFields() {
+		if _, ok := m.Fields[field]; !ok {
+			report.errorf(0, 0, "No %s column", field)
+		}
+	}
+	return m, report.Err()
+}
+
+// GetColumnAliases returns DefaultColumnAliases with the aliases listed in
+// ColumnsFile in `bucket` added, if there is such a file.
+func GetColumnAliases(bucket blob.Store) (ColumnAliases, error) {
+	aliases := ColumnAliases{}
+	for field, names := range DefaultColumnAliases {
+		aliases[field] = append([]string{}, names...)
+	}
+	extra := ColumnAliases{}
+	if err := readJSONConfig(bucket, ColumnsFile, &extra); err != nil {
+		return nil, err
+	}
+	for field, names := range extra {
+		if !isField(field) {
+			return nil, fmt.Errorf("Unknown field %q in %s", field, ColumnsFile)
+		}
+		aliases[field] = append(aliases[field], names...)
+	}
+	return aliases, nil
+}
@@ -0,0 +1,123 @@
+package loaddb
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMapColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		columns  []string
+		fields   map[string]string
+		unmapped []string
+		errors   int
+	}{
+		{
+			name:    "exact",
+			columns: []string{"Business Name", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday"},
+			fields: map[string]string{
+				"Business Name": "Business Name", "Monday": "Monday", "Tuesday": "Tuesday",
+				"Wednesday": "Wednesday", "Thursday": "Thursday", "Friday": "Friday",
+			},
+		},
+		{
+			name:     "aliases",
+			columns:  []string{"Vendor Name", "MONDAY ", "Tue", "wed.", "Thurs", "Fri", "Sat", "Notes"},
+			unmapped: []string{"Notes"},
+			fields: map[string]string{
+				"Business Name": "Vendor Name", "Monday": "MONDAY ", "Tuesday": "Tue",
+				"Wednesday": "wed.", "Thursday": "Thurs", "Friday": "Fri", "Saturday": "Sat",
+			},
+		},
+		{
+			name:    "missing",
+			columns: []string{"Business Name", "Monday", "Tuesday"},
+			errors:  3,
+		},
+		{
+			name:    "ambiguous",
+			columns: []string{"Business Name", "Vendor", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday"},
+			errors:  1,
+		},
+	}
+	for _, test := range tests {
+		rec := make(map[string]string)
+		for _, column := range test.columns {
+			rec[column] = ""
+		}
+		m, err := MapColumns(Records{rec}, nil)
+		if test.errors > 0 {
+			verr, ok := err.(*ValidationError)
+			if !ok || len(verr.Problems) != test.errors {
+				t.Errorf("%s: MapColumns returned error %v, want %d problems", test.name, err, test.errors)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: MapColumns returned error: %v", test.name, err)
+			continue
+		}
+		if !equalRecord(m.Fields, test.fields) {
+			t.Errorf("%s: MapColumns mapped %v, want %v", test.name, m.Fields, test.fields)
+		}
+		if strings.Join(m.Unmapped, ",") != strings.Join(test.unmapped, ",") {
+			t.Errorf("%s: MapColumns left %v unmapped, want %v", test.name, m.Unmapped, test.unmapped)
+		}
+	}
+
+	if _, err := MapColumns(nil, nil); err == nil {
+		t.Fatal("MapColumns failed to return an error for no data")
+	}
+}
+
+func TestProcessColumnAliases(t *testing.T) {
+	data := Records{
+		{"Vendor": "Foo Truck", "Mon": "Stop A", "Tue": "OFF", "Wed": "OFF", "Thu": "OFF", "Fri": "OFF"},
+	}
+	start := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := Process(data, ColumnAliases{}, start, end, nil); err == nil {
+		t.Fatal("Process accepted columns without their aliases")
+	}
+	schedule, err := Process(data, ColumnAliases{FieldTruck: {"Vendor"}, "Monday": {"Mon"},
+		"Tuesday": {"Tue"}, "Wednesday": {"Wed"}, "Thursday": {"Thu"}, "Friday": {"Fri"}}, start, end, nil)
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+	if a := schedule.Days["2019-07-01"]["Stop A"]; len(a) != 1 || a[0].Truck != "Foo Truck" {
+		t.Fatalf("Process returned wrong schedule: %v", schedule.Days)
+	}
+	if schedule.Columns.Fields["Monday"] != "Mon" {
+		t.Fatalf("Process returned wrong columns: %v", schedule.Columns)
+	}
+}
+
+func TestGetColumnAliases(t *testing.T) {
+	bucket, cleanup := newTestBucket(t)
+	defer cleanup()
+
+	aliases, err := GetColumnAliases(bucket)
+	if err != nil || len(aliases[FieldTruck]) != len(DefaultColumnAliases[FieldTruck]) {
+		t.Fatalf("GetColumnAliases returned %v, %v without a file", aliases, err)
+	}
+
+	putTestFile(t, bucket, ColumnsFile, `{"Business Name": ["Licensee"]}`)
+	aliases, err = GetColumnAliases(bucket)
+	if err != nil {
+		t.Fatalf("GetColumnAliases returned error: %v", err)
+	}
+	names := aliases[FieldTruck]
+	if len(names) != len(DefaultColumnAliases[FieldTruck])+1 || names[len(names)-1] != "Licensee" {
+		t.Fatalf("GetColumnAliases returned wrong aliases: %v", names)
+	}
+	if len(DefaultColumnAliases[FieldTruck]) != 6 {
+		t.Fatal("GetColumnAliases changed the default aliases")
+	}
+
+	putTestFile(t, bucket, ColumnsFile, `{"Vendor Name": ["Licensee"]}`)
+	if _, err := GetColumnAliases(bucket); err == nil {
+		t.Fatal("GetColumnAliases failed to return an error for an unknown field")
+	}
+}
@@ -0,0 +1,160 @@
+package loaddb
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// byteOrderMark is written at the start of CSVs by some tools, e.g. Excel.
+const byteOrderMark = "\ufeff"
+
+// A Problem is something wrong with a file. Row and Column count from 1,
+// with the header as row 1; either is 0 if the problem is not specific to
+// one. Rows are CSV records, so they differ from line numbers if the file
+// has blank lines or cells with line breaks.
+type Problem struct {
+	Row     int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Row > 0 && p.Column > 0:
+		return fmt.Sprintf("row %d, column %d: %s", p.Row, p.Column, p.Message)
+	case p.Row > 0:
+		return fmt.Sprintf("row %d: %s", p.Row, p.Message)
+	case p.Column > 0:
+		return fmt.Sprintf("column %d: %s", p.Column, p.Message)
+	}
+	return p.Message
+}
+
+// A ValidationReport lists the problems found in a file. Errors stop the
+// file from being loaded; warnings are problems which were worked around.
+type ValidationReport struct {
+	Errors   []Problem
+	Warnings []Problem
+}
+
+func (r *ValidationReport) errorf(row, column int, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, Problem{Row: row, Column: column, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ValidationReport) warnf(row, column int, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, Problem{Row: row, Column: column, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns a *ValidationError listing the errors, or nil if there are
+// none.
+func (r ValidationReport) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: r.Errors}
+}
+
+// A ValidationError is returned for a file with problems which stop it
+// from being loaded.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var problems []string
+	for _, p := range e.Problems {
+		problems = append(problems, p.String())
+	}
+	return "Invalid data: " + strings.Join(problems, "; ")
+}
+
+// readHeader returns the column names in a CSV header row, with any byte
+// order mark and surrounding whitespace removed. Columns with no name are
+// ignored, and are returned as empty strings.
+func readHeader(line []string, report *ValidationReport) []string {
+	fields := make([]string, len(line))
+	seen := make(map[string]int)
+	for i, name := range line {
+		if i == 0 {
+			name = strings.TrimPrefix(name, byteOrderMark)
+		}
+		name = strings.TrimSpace(name)
+		fields[i] = name
+		if name == "" {
+			continue
+		}
+		if j, ok := seen[name]; ok {
+			report.errorf(1, i+1, "Duplicate header %q, also in column %d", name, j+1)
+			continue
+		}
+		seen[name] = i
+	}
+	return fields
+}
+
+// ReadCSV returns a slice of maps corresponding to the rows in a CSV
+// provided in `data`, keyed by the header row, and a report of the
+// problems found. The error is the report's Err, or nil if the records can
+// be used.
+//
+// Rows with fewer cells than the header are padded with empty cells, and
+// cells beyond the header or under a column with no name are ignored, with
+// a warning if they are not empty.
+func ReadCSV(data io.Reader) (Records, ValidationReport, error) {
+	var report ValidationReport
+	r := csv.NewReader(data)
+	r.FieldsPerRecord = -1
+	var fields []string
+	var records Records
+	for row := 1; ; row++ {
+		line, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The position of a parse error is in lines and characters,
+			// not rows and cells.
+			if pe, ok := err.(*csv.ParseError); ok {
+				report.errorf(row, 0, "Line %d, character %d: %v", pe.Line, pe.Column, pe.Err)
+			} else {
+				report.errorf(row, 0, "%v", err)
+			}
+			break
+		}
+		if fields == nil {
+			fields = readHeader(line, &report)
+			continue
+		}
+		if len(line) < len(fields) {
+			report.warnf(row, 0, "Only %d cells, header has %d; the rest are taken to be empty", len(line), len(fields))
+		}
+		rec := make(map[string]string)
+		for _, name := range fields {
+			if name != "" {
+				rec[name] = ""
+			}
+		}
+		for i, cell := range line {
+			if i < len(fields) && fields[i] != "" {
+				rec[fields[i]] = cell
+			} else if strings.TrimSpace(cell) != "" {
+				report.warnf(row, i+1, "Ignoring %q, which has no header", cell)
+			}
+		}
+		records = append(records, rec)
+	}
+	if len(report.Errors) == 0 {
+		switch {
+		case fields == nil:
+			report.errorf(0, 0, "Empty file")
+		case len(records) == 0:
+			report.errorf(0, 0, "No rows after the header")
+		}
+	}
+	if err := report.Err(); err != nil {
+		return nil, report, err
+	}
+	return records, report, nil
+}
@@ -0,0 +1,120 @@
+package loaddb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadCSV(t *testing.T) {
+	data := "a,b,c\n1,2,3\n4,5,6"
+	recs, report, err := ReadCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadCSV returned error: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatal("ReadCSV returned the wrong number of rows")
+	}
+	if rec := recs[0]; rec["a"] != "1" || rec["b"] != "2" || rec["c"] != "3" {
+		t.Fatal("ReadCSV returned incorrect data")
+	}
+	if len(report.Errors) != 0 || len(report.Warnings) != 0 {
+		t.Fatalf("ReadCSV reported problems with valid data: %+v", report)
+	}
+}
+
+func TestReadCSVProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		errors   []Problem
+		warnings []Problem
+		first    map[string]string
+	}{
+		{
+			name:  "byte order mark and padded header",
+			data:  "\ufeff Business Name ,Monday \nFoo Truck,Stop A\n",
+			first: map[string]string{"Business Name": "Foo Truck", "Monday": "Stop A"},
+		},
+		{
+			name:     "short row",
+			data:     "a,b,c\n1,2\n",
+			warnings: []Problem{{Row: 2, Message: "Only 2 cells, header has 3; the rest are taken to be empty"}},
+			first:    map[string]string{"a": "1", "b": "2", "c": ""},
+		},
+		{
+			name:     "long row",
+			data:     "a,b\n1,2,,3\n",
+			warnings: []Problem{{Row: 2, Column: 4, Message: `Ignoring "3", which has no header`}},
+			first:    map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:     "column with no name",
+			data:     "a,,b\n1,x,2\n",
+			warnings: []Problem{{Row: 2, Column: 2, Message: `Ignoring "x", which has no header`}},
+			first:    map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:   "duplicate header",
+			data:   "a,b,a\n1,2,3\n",
+			errors: []Problem{{Row: 1, Column: 3, Message: `Duplicate header "a", also in column 1`}},
+		},
+		{
+			name:   "empty file",
+			data:   "",
+			errors: []Problem{{Message: "Empty file"}},
+		},
+		{
+			name:   "header only",
+			data:   "a,b\n",
+			errors: []Problem{{Message: "No rows after the header"}},
+		},
+		{
+			name:   "bad quote",
+			data:   "a,b\n1,2\n3,\"4\n",
+			errors: []Problem{{Row: 3, Message: "Line 3, character 6: extraneous or missing \" in quoted-field"}},
+		},
+	}
+	for _, test := range tests {
+		recs, report, err := ReadCSV(strings.NewReader(test.data))
+		if (err != nil) != (len(test.errors) > 0) {
+			t.Errorf("%s: ReadCSV returned error %v", test.name, err)
+			continue
+		}
+		if !equalProblems(report.Errors, test.errors) {
+			t.Errorf("%s: ReadCSV reported errors %v, want %v", test.name, report.Errors, test.errors)
+		}
+		if !equalProblems(report.Warnings, test.warnings) {
+			t.Errorf("%s: ReadCSV reported warnings %v, want %v", test.name, report.Warnings, test.warnings)
+		}
+		if test.first == nil {
+			continue
+		}
+		if len(recs) == 0 || !equalRecord(recs[0], test.first) {
+			t.Errorf("%s: ReadCSV returned %v, want first record %v", test.name, recs, test.first)
+		}
+	}
+}
+
+func equalProblems(a, b []Problem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalRecord(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package loaddb
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+)
+
+// DB stores trucks, stops, daily schedules, and the manifests and status
+// of processed files.
+type DB interface {
+	// TruckIDs returns the IDs of all trucks, keyed by the KeyName of each of
+	// the truck's names.
+	TruckIDs(ctx context.Context) (map[string]string, error)
+	// TruckDisplayNames returns the display name of each truck, keyed by ID.
+	TruckDisplayNames(ctx context.Context) (map[string]string, error)
+	// AddTrucks adds a new truck for each of the given names and returns
+	// their IDs, keyed by KeyName.
+	AddTrucks(ctx context.Context, names []string) (map[string]string, error)
+	// AddTruckNames adds other names for existing trucks. It maps the
+	// KeyName of each name to a truck ID.
+	AddTruckNames(ctx context.Context, names map[string]string) error
+	// AddPendingTrucks records truck names which need a maintainer to
+	// decide whether they are new trucks.
+	AddPendingTrucks(ctx context.Context, pending []PendingTruck) error
+	// DeleteTrucks deletes the trucks with the given IDs and the given
+	// truck names.
+	DeleteTrucks(ctx context.Context, ids []string, names []string) error
+	// StopIDs returns the IDs of all stops, keyed by the StopKeyName of each
+	// of the stop's names.
+	StopIDs(ctx context.Context) (map[string]string, error)
+	// AddStops adds a new stop for each of the given names and returns their
+	// IDs, keyed by StopKeyName.
+	AddStops(ctx context.Context, names []string) (map[string]string, error)
+	// DeleteStops deletes the stops with the given IDs and the given stop
+	// names.
+	DeleteStops(ctx context.Context, ids []string, names []string) error
+	// GetSchedules returns the stored schedules for the given dates. Dates
+	// with no schedule are left out.
+	GetSchedules(ctx context.Context, dates []string) (map[string]DailySchedule, error)
+	// SetSchedules replaces the schedules for the given dates. Each
+	// DailySchedule maps a stop ID to assignments of truck IDs to that stop.
+	SetSchedules(ctx context.Context, days map[string]DailySchedule) error
+	// DeleteSchedules deletes the schedules for the given dates.
+	DeleteSchedules(ctx context.Context, dates []string) error
+	// AddChangeLog records the changes made to the schedules by loading a
+	// file.
+	AddChangeLog(ctx context.Context, log ChangeLog) error
+	// GetManifest returns the manifest of the last load of a file, and
+	// whether there is one.
+	GetManifest(ctx context.Context, file string) (LoadManifest, bool, error)
+	// SetManifest saves the manifest of a load, replacing any earlier
+	// manifest for the same file.
+	SetManifest(ctx context.Context, m LoadManifest) error
+	// GetFileStatus returns the processing status of a file, and whether
+	// it has one.
+	GetFileStatus(ctx context.Context, file string) (FileStatus, bool, error)
+	// SetFileStatus records the processing status of a file.
+	SetFileStatus(ctx context.Context, file string, status FileStatus) error
+}
+
+const idChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// newID returns a random 20 character ID, in the same format as the IDs
+// Firestore generates for new documents.
+func newID() string {
+	b := make([]byte, 20)
+	max := big.NewInt(int64(len(idChars)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = idChars[n.Int64()]
+	}
+	return string(b)
+}
@@ -0,0 +1,113 @@
+package loaddb
+
+import (
+	"sort"
+	"time"
+)
+
+// A StopDiff holds the assignments added to and removed from a stop on one
+// day. A change to a truck's time window is a removal and an addition.
+type StopDiff struct {
+	Added   []Assignment `firestore:"added"`
+	Removed []Assignment `firestore:"removed"`
+}
+
+// DayDiff holds the changes to a day's schedule, keyed by stop ID.
+type DayDiff = map[string]StopDiff
+
+// A ChangeLog records the changes made to the schedules when a file was
+// loaded.
+type ChangeLog struct {
+	File string             `firestore:"file"`
+	Time time.Time          `firestore:"time"`
+	Days map[string]DayDiff `firestore:"days"`
+}
+
+// canonicalDay returns a day's schedule in the form it is stored: each
+// truck at most once per stop and time window, keyed by stop ID and then by
+// the truck ID, times and notes, so that windows which start at the same
+// time are kept apart.
+func canonicalDay(day DailySchedule) map[string]map[string]Assignment {
+	result := make(map[string]map[string]Assignment)
+	for stop, trucks := range scheduleDoc(day) {
+		if len(trucks) == 0 {
+			continue
+		}
+		result[stop] = make(map[string]Assignment)
+		for truck, doc := range trucks {
+			for _, w := range doc.Windows {
+				key := truck + " " + w.Start + " " + w.End + " " + w.Notes
+				result[stop][key] = Assignment{Truck: truck, Start: w.Start, End: w.End, Notes: w.Notes}
+			}
+		}
+	}
+	return result
+}
+
+// sortAssignments sorts assignments by truck and then time.
+func sortAssignments(assignments []Assignment) {
+	sort.Slice(assignments, func(i, j int) bool {
+		a, b := assignments[i], assignments[j]
+		if a.Truck != b.Truck {
+			return a.Truck < b.Truck
+		}
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		if a.End != b.End {
+			return a.End < b.End
+		}
+		return a.Notes < b.Notes
+	})
+}
+
+// DiffDay returns the changes from one day's schedule to another, leaving
+// out stops which have not changed. It compares schedules as they are
+// stored, so assignments which would be stored the same way are equal.
+func DiffDay(old DailySchedule, new DailySchedule) DayDiff {
+	before, after := canonicalDay(old), canonicalDay(new)
+	diff := DayDiff{}
+	for stop, trucks := range after {
+		var d StopDiff
+		for key, a := range trucks {
+			if _, ok := before[stop][key]; !ok {
+				d.Added = append(d.Added, a)
+			}
+		}
+		for key, a := range before[stop] {
+			if _, ok := trucks[key]; !ok {
+				d.Removed = append(d.Removed, a)
+			}
+		}
+		if len(d.Added) > 0 || len(d.Removed) > 0 {
+			sortAssignments(d.Added)
+			sortAssignments(d.Removed)
+			diff[stop] = d
+		}
+	}
+	for stop, trucks := range before {
+		if _, ok := after[stop]; ok {
+			continue
+		}
+		var d StopDiff
+		for _, a := range trucks {
+			d.Removed = append(d.Removed, a)
+		}
+		sortAssignments(d.Removed)
+		diff[stop] = d
+	}
+	return diff
+}
+
+// DiffSchedules returns the changes from the `old` to the `new` schedule
+// for each day in `new` which has changed. Days missing from `old` are
+// taken to have been empty.
+func DiffSchedules(old map[string]DailySchedule, new map[string]DailySchedule) map[string]DayDiff {
+	diffs := make(map[string]DayDiff)
+	for date, day := range new {
+		if d := DiffDay(old[date], day); len(d) > 0 {
+			diffs[date] = d
+		}
+	}
+	return diffs
+}
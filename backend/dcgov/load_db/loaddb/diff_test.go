@@ -0,0 +1,102 @@
+package loaddb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffDay(t *testing.T) {
+	old := DailySchedule{
+		"A": {{Truck: "foo"}, {Truck: "bar", Start: "11:00", End: "14:00"}},
+		"B": {{Truck: "baz"}},
+		"C": {},
+	}
+	new := DailySchedule{
+		"A": {{Truck: "foo"}, {Truck: "bar", Start: "11:00", End: "15:00"}},
+		"C": {{Truck: "baz"}},
+	}
+	expected := DayDiff{
+		"A": {
+			Added:   []Assignment{{Truck: "bar", Start: "11:00", End: "15:00"}},
+			Removed: []Assignment{{Truck: "bar", Start: "11:00", End: "14:00"}},
+		},
+		"B": {Removed: []Assignment{{Truck: "baz"}}},
+		"C": {Added: []Assignment{{Truck: "baz"}}},
+	}
+	if diff := DiffDay(old, new); !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("DiffDay returned %v, want %v", diff, expected)
+	}
+
+	// Assignments which are stored the same way are equal.
+	same := DailySchedule{
+		"A": {{Truck: "bar", Start: "11:00", End: "14:00"}, {Truck: "foo"}},
+		"B": {{Truck: "baz"}, {Truck: "baz"}},
+	}
+	if diff := DiffDay(old, same); len(diff) != 0 {
+		t.Fatalf("DiffDay returned %v for the same schedule", diff)
+	}
+
+	// Windows which start at the same time are compared by their end and
+	// notes too.
+	tests := []struct {
+		old, new DailySchedule
+		expected DayDiff
+	}{
+		{
+			old: DailySchedule{"A": {
+				{Truck: "bar", Start: "11:00", End: "14:00"},
+				{Truck: "bar", Start: "11:00", End: "15:00"},
+			}},
+			new: DailySchedule{"A": {{Truck: "bar", Start: "11:00", End: "15:00"}}},
+			expected: DayDiff{"A": {
+				Removed: []Assignment{{Truck: "bar", Start: "11:00", End: "14:00"}},
+			}},
+		},
+		{
+			old: DailySchedule{"A": {{Truck: "bar", Start: "11:00", End: "14:00"}}},
+			new: DailySchedule{"A": {{Truck: "bar", Start: "11:00", End: "14:00", Notes: "Fridays only"}}},
+			expected: DayDiff{"A": {
+				Added:   []Assignment{{Truck: "bar", Start: "11:00", End: "14:00", Notes: "Fridays only"}},
+				Removed: []Assignment{{Truck: "bar", Start: "11:00", End: "14:00"}},
+			}},
+		},
+		{
+			old: DailySchedule{"A": {{Truck: "bar", Start: "11:00", End: "14:00"}}},
+			new: DailySchedule{"A": {
+				{Truck: "bar", Start: "11:00", End: "15:00"},
+				{Truck: "bar", Start: "11:00", End: "14:00"},
+			}},
+			expected: DayDiff{"A": {
+				Added: []Assignment{{Truck: "bar", Start: "11:00", End: "15:00"}},
+			}},
+		},
+	}
+	for _, test := range tests {
+		if diff := DiffDay(test.old, test.new); !reflect.DeepEqual(diff, test.expected) {
+			t.Errorf("DiffDay(%v, %v) = %v, want %v", test.old, test.new, diff, test.expected)
+		}
+	}
+}
+
+func TestDiffSchedules(t *testing.T) {
+	old := map[string]DailySchedule{
+		"2019-07-01": {"A": {{Truck: "foo"}}},
+		"2019-07-02": {"A": {{Truck: "foo"}}},
+	}
+	new := map[string]DailySchedule{
+		"2019-07-01": {"A": {{Truck: "foo"}}},
+		"2019-07-02": {"A": {{Truck: "bar"}}},
+		"2019-07-03": {"A": {{Truck: "foo"}}},
+		"2019-07-04": {},
+	}
+	diffs := DiffSchedules(old, new)
+	if len(diffs) != 2 {
+		t.Fatalf("DiffSchedules returned %d days, want 2: %v", len(diffs), diffs)
+	}
+	if _, ok := diffs["2019-07-02"]; !ok {
+		t.Fatal("DiffSchedules did not return a changed day")
+	}
+	if _, ok := diffs["2019-07-03"]; !ok {
+		t.Fatal("DiffSchedules did not return a new day")
+	}
+}
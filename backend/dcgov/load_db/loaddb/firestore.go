@@ -0,0 +1,470 @@
+package loaddb
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// FirestoreDB is a DB backed by Cloud Firestore.
+type FirestoreDB struct {
+	client *firestore.Client
+}
+
+// NewFirestoreDB returns a DB for the given Google Cloud project.
+// The caller must call Close when done.
+func NewFirestoreDB(ctx context.Context, project string) (*FirestoreDB, error) {
+	client, err := firestore.NewClient(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	return &FirestoreDB{client: client}, nil
+}
+
+// Close closes the underlying Firestore client.
+func (db *FirestoreDB) Close() error {
+	return db.client.Close()
+}
+
+// ID holds an ID corresponding to a name, retrieved from the database.
+type ID struct {
+	ID string `firestoreValue:"id"`
+}
+
+// TruckIDs returns all existing truck IDs in the database.
+func (db *FirestoreDB) TruckIDs(ctx context.Context) (map[string]string, error) {
+	truckIDs := make(map[string]string)
+	docs, err := db.client.Collection("truckNames").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		key := doc.Ref.ID
+		var id ID
+		err = doc.DataTo(&id)
+		if err != nil {
+			return nil, err
+		}
+		truckIDs[key] = id.ID
+	}
+	return truckIDs, nil
+}
+
+// TruckDisplayNames returns the display name of each truck in the database.
+func (db *FirestoreDB) TruckDisplayNames(ctx context.Context) (map[string]string, error) {
+	trucks := make(map[string]string)
+	docs, err := db.client.Collection("trucks").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		name, err := doc.DataAt("displayName")
+		if err != nil {
+			return nil, err
+		}
+		trucks[doc.Ref.ID], _ = name.(string)
+	}
+	return trucks, nil
+}
+
+// AddTruckID adds a new truck and its name to the same batch and returns
+// its ID.
+func AddTruckID(ctx context.Context, w *BatchWriter, truck string, client *firestore.Client) (string, error) {
+	truckRef := client.Collection("trucks").NewDoc()
+	truckID := truckRef.ID
+	nameRef := client.Collection("truckNames").Doc(KeyName(truck))
+	if err := w.Reserve(ctx, 2); err != nil {
+		return "", err
+	}
+	if err := w.Set(ctx, truckRef, map[string]string{"displayName": truck}); err != nil {
+		return "", err
+	}
+	if err := w.Set(ctx, nameRef, map[string]string{"id": truckID}); err != nil {
+		return "", err
+	}
+	return truckID, nil
+}
+
+// AddTrucks adds new trucks to the database and returns their IDs.
+func (db *FirestoreDB) AddTrucks(ctx context.Context, names []string) (map[string]string, error) {
+	truckIDs := make(map[string]string)
+	w := NewBatchWriter(db.client)
+	for _, truck := range names {
+		id, err := AddTruckID(ctx, w, truck, db.client)
+		if err != nil {
+			return nil, err
+		}
+		truckIDs[KeyName(truck)] = id
+	}
+	if err := w.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return truckIDs, nil
+}
+
+// AddTruckNames adds other names for existing trucks, and removes them
+// from the names awaiting review.
+func (db *FirestoreDB) AddTruckNames(ctx context.Context, names map[string]string) error {
+	w := NewBatchWriter(db.client)
+	for key, id := range names {
+		if err := w.Reserve(ctx, 2); err != nil {
+			return err
+		}
+		if err := w.Set(ctx, db.client.Collection("truckNames").Doc(key), map[string]string{"id": id}); err != nil {
+			return err
+		}
+		if err := w.Delete(ctx, db.client.Collection("pendingTruckNames").Doc(key)); err != nil {
+			return err
+		}
+	}
+	return w.Flush(ctx)
+}
+
+// AddPendingTrucks records truck names awaiting review in the
+// pendingTruckNames collection, keyed by KeyName.
+func (db *FirestoreDB) AddPendingTrucks(ctx context.Context, pending []PendingTruck) error {
+	w := NewBatchWriter(db.client)
+	for _, p := range pending {
+		if err := w.Set(ctx, db.client.Collection("pendingTruckNames").Doc(KeyName(p.Name)), p); err != nil {
+			return err
+		}
+	}
+	return w.Flush(ctx)
+}
+
+// DeleteTrucks deletes trucks and truck names.
+func (db *FirestoreDB) DeleteTrucks(ctx context.Context, ids []string, names []string) error {
+	w := NewBatchWriter(db.client)
+	for _, id := range ids {
+		if err := w.Delete(ctx, db.client.Collection("trucks").Doc(id)); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if err := w.Delete(ctx, db.client.Collection("truckNames").Doc(name)); err != nil {
+			return err
+		}
+	}
+	return w.Flush(ctx)
+}
+
+// StopIDs returns all existing stop IDs in the database.
+func (db *FirestoreDB) StopIDs(ctx context.Context) (map[string]string, error) {
+	stopIDs := make(map[string]string)
+	docs, err := db.client.Collection("stopNames").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		var id ID
+		if err := doc.DataTo(&id); err != nil {
+			return nil, err
+		}
+		stopIDs[doc.Ref.ID] = id.ID
+	}
+	return stopIDs, nil
+}
+
+// AddStops adds new stops to the database and returns their IDs. New stops
+// have no location until one is added with the stops loader.
+func (db *FirestoreDB) AddStops(ctx context.Context, names []string) (map[string]string, error) {
+	stopIDs := make(map[string]string)
+	w := NewBatchWriter(db.client)
+	for _, stop := range names {
+		stopRef := db.client.Collection("stops").NewDoc()
+		nameRef := db.client.Collection("stopNames").Doc(StopKeyName(stop))
+		if err := w.Reserve(ctx, 2); err != nil {
+			return nil, err
+		}
+		if err := w.Set(ctx, stopRef, map[string]string{"displayName": strings.TrimSpace(stop)}); err != nil {
+			return nil, err
+		}
+		if err := w.Set(ctx, nameRef, map[string]string{"id": stopRef.ID}); err != nil {
+			return nil, err
+		}
+		stopIDs[StopKeyName(stop)] = stopRef.ID
+	}
+	if err := w.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return stopIDs, nil
+}
+
+// A windowDoc is one of a truck's times at a stop in a schedule document.
+// Start and End are empty if the truck is there all day.
+type windowDoc struct {
+	Start string `firestore:"start,omitempty"`
+	End   string `firestore:"end,omitempty"`
+	Notes string `firestore:"notes,omitempty"`
+}
+
+// A truckDoc is a truck's entry at a stop in a schedule document.
+type truckDoc struct {
+	Windows []windowDoc `firestore:"windows"`
+}
+
+// addWindow returns `windows` with the time window of `a` added. A truck
+// which is at a stop all day has one window with no times. Otherwise its
+// windows are kept separately, e.g. for lunch and dinner, in order, and a
+// window listed twice is stored once.
+func addWindow(windows []windowDoc, a Assignment) []windowDoc {
+	w := windowDoc{Start: a.Start, End: a.End, Notes: a.Notes}
+	if len(windows) > 0 && windows[0].Start == "" {
+		if windows[0].Notes == "" {
+			windows[0].Notes = a.Notes
+		}
+		return windows
+	}
+	if a.Start == "" {
+		for _, other := range windows {
+			if w.Notes == "" {
+				w.Notes = other.Notes
+			}
+		}
+		return []windowDoc{w}
+	}
+	for i, other := range windows {
+		if other.Start == w.Start && other.End == w.End {
+			if other.Notes == "" {
+				windows[i].Notes = w.Notes
+			}
+			return windows
+		}
+	}
+	windows = append(windows, w)
+	sort.Slice(windows, func(i, j int) bool {
+		if windows[i].Start != windows[j].Start {
+			return windows[i].Start < windows[j].Start
+		}
+		return windows[i].End < windows[j].End
+	})
+	return windows
+}
+
+// scheduleDoc returns the document for a day's schedule. It maps each stop
+// ID to the IDs of the trucks at that stop, and each truck ID to its time
+// windows there, as by addWindow.
+func scheduleDoc(stops DailySchedule) map[string]map[string]truckDoc {
+	data := make(map[string]map[string]truckDoc)
+	for stop, assignments := range stops {
+		data[stop] = map[string]truckDoc{}
+		for _, a := range assignments {
+			doc := data[stop][a.Truck]
+			doc.Windows = addWindow(doc.Windows, a)
+			data[stop][a.Truck] = doc
+		}
+	}
+	return data
+}
+
+// DeleteStops deletes stops and stop names.
+func (db *FirestoreDB) DeleteStops(ctx context.Context, ids []string, names []string) error {
+	w := NewBatchWriter(db.client)
+	for _, id := range ids {
+		if err := w.Delete(ctx, db.client.Collection("stops").Doc(id)); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if err := w.Delete(ctx, db.client.Collection("stopNames").Doc(name)); err != nil {
+			return err
+		}
+	}
+	return w.Flush(ctx)
+}
+
+// scheduleFromDoc returns a day's schedule from its document, the reverse
+// of scheduleDoc. Older documents have a single window, or none, in place
+// of the list of windows.
+func scheduleFromDoc(data map[string]interface{}) DailySchedule {
+	day := DailySchedule{}
+	for stop, v := range data {
+		trucks, _ := v.(map[string]interface{})
+		day[stop] = []Assignment{}
+		for truck, t := range trucks {
+			doc, _ := t.(map[string]interface{})
+			windows, ok := doc["windows"].([]interface{})
+			if !ok {
+				windows = []interface{}{doc}
+			}
+			for _, w := range windows {
+				a := Assignment{Truck: truck}
+				if window, ok := w.(map[string]interface{}); ok {
+					a.Start, _ = window["start"].(string)
+					a.End, _ = window["end"].(string)
+					a.Notes, _ = window["notes"].(string)
+				}
+				day[stop] = append(day[stop], a)
+			}
+		}
+	}
+	return day
+}
+
+// GetSchedules returns the stored schedules for the given dates.
+func (db *FirestoreDB) GetSchedules(ctx context.Context, dates []string) (map[string]DailySchedule, error) {
+	var refs []*firestore.DocumentRef
+	for _, date := range dates {
+		refs = append(refs, db.client.Collection("schedules").Doc(date))
+	}
+	docs, err := db.client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	days := make(map[string]DailySchedule)
+	for _, doc := range docs {
+		if doc.Exists() {
+			days[doc.Ref.ID] = scheduleFromDoc(doc.Data())
+		}
+	}
+	return days, nil
+}
+
+// SetSchedules replaces the schedules for the given dates, in date order.
+// If it fails part way, the error says how many days were written.
+func (db *FirestoreDB) SetSchedules(ctx context.Context, days map[string]DailySchedule) error {
+	var dates []string
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	w := NewBatchWriter(db.client)
+	for _, date := range dates {
+		docRef := db.client.Collection("schedules").Doc(date)
+		if err := w.Set(ctx, docRef, scheduleDoc(days[date])); err != nil {
+			return err
+		}
+	}
+	return w.Flush(ctx)
+}
+
+// DeleteSchedules deletes the schedules for the given dates.
+func (db *FirestoreDB) DeleteSchedules(ctx context.Context, dates []string) error {
+	w := NewBatchWriter(db.client)
+	for _, date := range dates {
+		if err := w.Delete(ctx, db.client.Collection("schedules").Doc(date)); err != nil {
+			return err
+		}
+	}
+	return w.Flush(ctx)
+}
+
+// AddChangeLog records the changes made to the schedules by a load in the
+// scheduleChanges collection.
+func (db *FirestoreDB) AddChangeLog(ctx context.Context, log ChangeLog) error {
+	_, _, err := db.client.Collection("scheduleChanges").Add(ctx, log)
+	return err
+}
+
+// GetManifest returns the manifest of the last load of a file from the
+// loadManifests collection.
+func (db *FirestoreDB) GetManifest(ctx context.Context, file string) (LoadManifest, bool, error) {
+	ref := db.client.Collection("loadManifests").Doc(file)
+	doc, err := ref.Get(ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return LoadManifest{}, false, nil
+	}
+	if err != nil {
+		return LoadManifest{}, false, err
+	}
+	var m LoadManifest
+	if err := doc.DataTo(&m); err != nil {
+		return LoadManifest{}, false, err
+	}
+	if len(m.Dates) == 0 {
+		return m, true, nil
+	}
+	docs, err := ref.Collection("previous").Documents(ctx).GetAll()
+	if err != nil {
+		return LoadManifest{}, false, err
+	}
+	m.Previous = make(map[string]DailySchedule)
+	for _, doc := range docs {
+		var p previousDoc
+		if err := doc.DataTo(&p); err != nil {
+			return LoadManifest{}, false, err
+		}
+		if p.Started.Equal(m.Started) {
+			m.Previous[doc.Ref.ID] = p.Schedule
+		}
+	}
+	return m, true, nil
+}
+
+// A previousDoc is the schedule of one day before a load, keyed by date in
+// the previous subcollection of the load's manifest.
+type previousDoc struct {
+	// Started is when the load started, so that days left from an earlier
+	// load of the same file can be told apart.
+	Started  time.Time     `firestore:"started"`
+	Schedule DailySchedule `firestore:"schedule"`
+}
+
+// SetManifest saves the manifest of a load in the loadManifests
+// collection. The schedules from before the load are saved one day per
+// document in the manifest's previous subcollection, since for a file of
+// several months they could exceed the size limit of one document. The
+// manifest is written after them, so it never refers to unsaved days.
+func (db *FirestoreDB) SetManifest(ctx context.Context, m LoadManifest) error {
+	ref := db.client.Collection("loadManifests").Doc(m.File)
+	w := NewBatchWriter(db.client)
+	for date, day := range m.Previous {
+		p := previousDoc{Started: m.Started, Schedule: day}
+		if err := w.Set(ctx, ref.Collection("previous").Doc(date), p); err != nil {
+			return err
+		}
+	}
+	if err := w.Set(ctx, ref, m); err != nil {
+		return err
+	}
+	return w.Flush(ctx)
+}
+
+// GetFileStatus returns the processing status of a file from the
+// dcGovFiles collection.
+func (db *FirestoreDB) GetFileStatus(ctx context.Context, file string) (FileStatus, bool, error) {
+	doc, err := db.client.Collection("dcGovFiles").Doc(file).Get(ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return FileStatus{}, false, nil
+	}
+	if err != nil {
+		return FileStatus{}, false, err
+	}
+	var status FileStatus
+	if err := doc.DataTo(&status); err != nil {
+		return FileStatus{}, false, err
+	}
+	return status, true, nil
+}
+
+// SetFileStatus records the processing status of a file. Fields written
+// by other stages, e.g. the source URL, are kept, as is the provenance of
+// the last successful load if the status has none. Provenance is replaced
+// as a whole, so nothing from an earlier load, e.g. its columns, is left.
+func (db *FirestoreDB) SetFileStatus(ctx context.Context, file string, status FileStatus) error {
+	fileRef := db.client.Collection("dcGovFiles").Doc(file)
+	data := map[string]interface{}{
+		"ok":           status.OK,
+		"state":        status.State,
+		"attempts":     status.Attempts,
+		"stage":        status.Stage,
+		"lastError":    status.LastError,
+		"firstAttempt": status.FirstAttempt,
+		"lastAttempt":  status.LastAttempt,
+		"nextAttempt":  status.NextAttempt,
+	}
+	if status.Provenance != nil {
+		data["provenance"] = status.Provenance
+	}
+	var fields []firestore.FieldPath
+	for field := range data {
+		fields = append(fields, firestore.FieldPath{field})
+	}
+	_, err := fileRef.Set(ctx, data, firestore.Merge(fields...))
+	return err
+}
@@ -0,0 +1,126 @@
+package loaddb
+
+import (
+	"strconv"
+	"time"
+
+	"foodtrucks/dcgov/blob"
+)
+
+// ClosuresFile is the name of the object in the bucket which lists ad-hoc
+// days on which the MRV program does not run, e.g. snow days, as a JSON
+// object mapping dates in the form "2006-01-02" to a description.
+const ClosuresFile = "closures.json"
+
+// Calendar maps dates in the form "2006-01-02" on which the MRV program does
+// not run to the name of the holiday or closure.
+type Calendar = map[string]string
+
+// date returns midnight UTC on the given day.
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// nthWeekday returns the nth weekday in a month, e.g. the third Monday.
+// If n is negative, it counts from the end of the month.
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	if n < 0 {
+		last := date(year, month+1, 0)
+		offset := (int(last.Weekday()) - int(weekday) + 7) % 7
+		return last.AddDate(0, 0, -offset+7*(n+1))
+	}
+	first := date(year, month, 1)
+	offset := (int(weekday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+7*(n-1))
+}
+
+// observed returns the day a fixed-date holiday is observed: the Friday
+// before if it falls on a Saturday, or the Monday after if on a Sunday.
+func observed(d time.Time) time.Time {
+	switch d.Weekday() {
+	case time.Saturday:
+		return d.AddDate(0, 0, -1)
+	case time.Sunday:
+		return d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// holidaysFor returns the federal and DC holidays whose actual date falls
+// in year, keyed by their observed date.
+func holidaysFor(year int) Calendar {
+	h := Calendar{}
+	add := func(d time.Time, name string) {
+		h[d.Format("2006-01-02")] = name
+	}
+	add(observed(date(year, time.January, 1)), "New Year's Day")
+	add(nthWeekday(year, time.January, time.Monday, 3), "Martin Luther King Jr. Day")
+	// Inauguration Day is a holiday in DC every four years, moved to
+	// Monday if it falls on a Sunday.
+	if year%4 == 1 {
+		if d := date(year, time.January, 20); d.Weekday() == time.Sunday {
+			add(d.AddDate(0, 0, 1), "Inauguration Day")
+		} else {
+			add(d, "Inauguration Day")
+		}
+	}
+	add(nthWeekday(year, time.February, time.Monday, 3), "Washington's Birthday")
+	add(observed(date(year, time.April, 16)), "DC Emancipation Day")
+	add(nthWeekday(year, time.May, time.Monday, -1), "Memorial Day")
+	if year >= 2021 {
+		add(observed(date(year, time.June, 19)), "Juneteenth")
+	}
+	add(observed(date(year, time.July, 4)), "Independence Day")
+	add(nthWeekday(year, time.September, time.Monday, 1), "Labor Day")
+	add(nthWeekday(year, time.October, time.Monday, 2), "Columbus Day")
+	add(observed(date(year, time.November, 11)), "Veterans Day")
+	add(nthWeekday(year, time.November, time.Thursday, 4), "Thanksgiving Day")
+	add(observed(date(year, time.December, 25)), "Christmas Day")
+	return h
+}
+
+// Holidays returns the federal and DC holidays observed in year, when the
+// MRV program does not run. Holidays on a Saturday are observed the Friday
+// before and those on a Sunday the Monday after, so New Year's Day of the
+// following year may be observed on December 31.
+func Holidays(year int) Calendar {
+	h := Calendar{}
+	for _, y := range []int{year, year + 1} {
+		for d, name := range holidaysFor(y) {
+			if d[0:4] == strconv.Itoa(year) {
+				h[d] = name
+			}
+		}
+	}
+	return h
+}
+
+// NewCalendar returns a Calendar holding all holidays from start to end,
+// inclusive, and the given ad-hoc closures.
+func NewCalendar(start time.Time, end time.Time, closures Calendar) Calendar {
+	c := Calendar{}
+	for year := start.Year(); year <= end.Year(); year++ {
+		for d, name := range Holidays(year) {
+			c[d] = name
+		}
+	}
+	for d, name := range closures {
+		c[d] = name
+	}
+	return c
+}
+
+// GetClosures returns the ad-hoc closures listed in ClosuresFile in
+// `bucket`, or none if there is no such file.
+func GetClosures(bucket blob.Store) (Calendar, error) {
+	closures := Calendar{}
+	if err := readJSONConfig(bucket, ClosuresFile, &closures); err != nil {
+		return nil, err
+	}
+	for d := range closures {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return nil, err
+		}
+	}
+	return closures, nil
+}
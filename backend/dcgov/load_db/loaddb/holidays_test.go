@@ -0,0 +1,77 @@
+package loaddb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHolidays(t *testing.T) {
+	tests := []struct {
+		year int
+		date string
+		name string
+	}{
+		{2019, "2019-01-21", "Martin Luther King Jr. Day"},
+		{2019, "2019-04-16", "DC Emancipation Day"},
+		{2019, "2019-05-27", "Memorial Day"},
+		{2019, "2019-11-28", "Thanksgiving Day"},
+		{2020, "2020-04-16", "DC Emancipation Day"},
+		{2020, "2020-07-03", "Independence Day"},
+		{2021, "2021-01-20", "Inauguration Day"},
+		{2021, "2021-06-18", "Juneteenth"},
+		{2021, "2021-12-24", "Christmas Day"},
+		{2021, "2021-12-31", "New Year's Day"},
+		{2022, "2022-04-15", "DC Emancipation Day"},
+		{2023, "2023-01-02", "New Year's Day"},
+		{2023, "2023-04-17", "DC Emancipation Day"},
+	}
+	for _, test := range tests {
+		h := Holidays(test.year)
+		if h[test.date] != test.name {
+			t.Errorf("Holidays(%d)[%s] = %q, want %q", test.year, test.date, h[test.date], test.name)
+		}
+	}
+	if n := len(Holidays(2019)); n != 11 {
+		t.Errorf("Holidays(2019) returned %d holidays, want 11", n)
+	}
+	if _, ok := Holidays(2022)["2022-12-31"]; ok {
+		t.Error("Holidays(2022) included New Year's Day 2022 on its actual date")
+	}
+}
+
+func TestNewCalendar(t *testing.T) {
+	start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, time.January, 31, 0, 0, 0, 0, time.UTC)
+	c := NewCalendar(start, end, Calendar{"2021-01-26": "Snow day"})
+	if c["2021-01-26"] != "Snow day" || c["2021-01-18"] != "Martin Luther King Jr. Day" {
+		t.Fatalf("NewCalendar returned wrong calendar: %v", c)
+	}
+}
+
+func TestGetClosures(t *testing.T) {
+	bucket, cleanup := newTestBucket(t)
+	defer cleanup()
+
+	closures, err := GetClosures(bucket)
+	if err != nil || len(closures) != 0 {
+		t.Fatalf("GetClosures returned %v, %v without a file", closures, err)
+	}
+
+	putTestFile(t, bucket, ClosuresFile, `{"2019-01-14": "Snow day"}`)
+	closures, err = GetClosures(bucket)
+	if err != nil {
+		t.Fatalf("GetClosures returned error: %v", err)
+	}
+	if closures["2019-01-14"] != "Snow day" {
+		t.Fatalf("GetClosures returned wrong closures: %v", closures)
+	}
+
+	putTestFile(t, bucket, ClosuresFile, `{"Jan 14": "Snow day"}`)
+	if _, err := GetClosures(bucket); err == nil {
+		t.Fatal("GetClosures failed to return an error for an invalid date")
+	}
+	putTestFile(t, bucket, ClosuresFile, `["2019-01-14"]`)
+	if _, err := GetClosures(bucket); err == nil {
+		t.Fatal("GetClosures failed to return an error for invalid JSON")
+	}
+}
@@ -3,19 +3,18 @@ package loaddb
 import (
 	"bytes"
 	"context"
-	"encoding/csv"
+	"encoding/json"
 	"errors"
-	"io"
-	"io/ioutil"
+	"fmt"
+	"log"
 	"path"
 	"path/filepath"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
-	"cloud.google.com/go/firestore"
-	"cloud.google.com/go/storage"
+	"foodtrucks/dcgov/blob"
 )
 
 var months = map[string]int{
@@ -33,138 +32,232 @@ var months = map[string]int{
 	"dec": 12,
 }
 
-// GetMonthAndYear returns the month and year from a string
-// of the form "Jan 2006...".
+// GetMonthAndYear returns the month and year from a string such as
+// "Jan 2006..." or "Results for 2006-01". If the string names more than one
+// month, it returns the first. See ParsePeriod for the forms recognized.
 func GetMonthAndYear(s string) (time.Month, int, error) {
-	re := regexp.MustCompile(`^(.+) ?(\d{4})`)
-	matches := re.FindStringSubmatch(s)
-	if len(matches) != 3 {
-		return time.Month(0), 0, errors.New("Invalid string")
-	}
-	m, y := matches[1], matches[2]
-	month, ok := months[strings.ToLower(m[0:3])]
-	if !ok {
-		return 0, 0, errors.New("Cannot convert month to int")
-	}
-	year, err := strconv.Atoi(y)
+	period, err := ParsePeriod(s)
 	if err != nil {
-		return 0, 0, errors.New("Cannot convert year to int")
+		return 0, 0, err
 	}
-	return time.Month(month), year, nil
+	return period[0].Month, period[0].Year, nil
 }
 
-// GetFile returns an array of bytes for `file` in `bucket`.
-func GetFile(file string, bucket string) ([]byte, error) {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return nil, err
-	}
+// metadataSources are the object metadata keys, set when a PDF is fetched,
+// which may contain text naming the months the file covers, in order of
+// preference.
+var metadataSources = []string{"linkText", "linkTitle", "linkLabel", "linkHeading", "pdfTitle"}
 
-	rc, err := client.Bucket(bucket).Object(file).NewReader(ctx)
-	if err != nil {
-		return nil, err
+// fileMetadata returns the metadata of `file` in `bucket`, or if it has
+// none, the metadata of the PDF it was converted from, and a description of
+// each object tried which had none.
+func fileMetadata(ctx context.Context, file string, bucket blob.Store) (map[string]string, []string) {
+	var tried []string
+	names := []string{file}
+	if pdf := strings.TrimSuffix(file, path.Ext(file)) + ".pdf"; pdf != file {
+		names = append(names, pdf)
 	}
-	defer rc.Close()
-
-	data, err := ioutil.ReadAll(rc)
-	if err != nil {
-		return nil, err
+	for _, name := range names {
+		attrs, err := bucket.Stat(ctx, name)
+		if err != nil {
+			tried = append(tried, fmt.Sprintf("metadata of %q (%v)", name, err))
+			continue
+		}
+		if len(attrs.Metadata) > 0 {
+			return attrs.Metadata, tried
+		}
+		tried = append(tried, fmt.Sprintf("metadata of %q (none)", name))
 	}
-	return data, nil
+	return map[string]string{}, tried
 }
 
-// Records holds a slice of key/value pairs representing the records in a CSV.
-type Records = []map[string]string
+// GetFileMetadata returns the metadata saved when the PDF that `file` was
+// converted from was fetched, e.g. its source URL, or an empty map if there
+// is none.
+func GetFileMetadata(file string, bucket blob.Store) map[string]string {
+	meta, _ := fileMetadata(context.Background(), file, bucket)
+	return meta
+}
 
-// ReadCSV returns a slice of maps corresponding to the rows
-// in a CSV provided in `data`.
-func ReadCSV(data io.Reader) (Records, error) {
-	r := csv.NewReader(data)
-	lines, err := r.ReadAll()
-	if err != nil {
-		return nil, err
-	}
-	var records []map[string]string
-	fields := lines[0]
-	for _, line := range lines[1:] {
-		rec := make(map[string]string)
-		for i := 0; i < len(fields); i++ {
-			rec[fields[i]] = line[i]
+// GetFilePeriod returns the months covered by `file` in `bucket`. It prefers
+// the object's metadata, or if it has none, the metadata of the PDF it was
+// converted from, then falls back to parsing the file name. Text naming only
+// a fiscal year or quarter, e.g. the heading above a monthly file's link, is
+// used only if nothing names a month. The error lists every source tried.
+func GetFilePeriod(file string, bucket blob.Store) ([]YearMonth, error) {
+	meta, tried := fileMetadata(context.Background(), file, bucket)
+
+	// fiscal is the first period found which was only a fiscal year or
+	// quarter.
+	var fiscal []YearMonth
+	parse := func(source, value string) []YearMonth {
+		period, isFiscal, err := parsePeriod(value)
+		switch {
+		case err != nil:
+			tried = append(tried, fmt.Sprintf("%s %q (%v)", source, value, err))
+		case isFiscal:
+			tried = append(tried, fmt.Sprintf("%s %q (fiscal year only)", source, value))
+			if fiscal == nil {
+				fiscal = period
+			}
+		default:
+			return period
 		}
-		records = append(records, rec)
+		return nil
+	}
 
+	// The month metadata is a single month found in the same text, so try
+	// the text first in case it names a range of months.
+	for _, key := range metadataSources {
+		if value, ok := meta[key]; ok {
+			if period := parse(key, value); period != nil {
+				return period, nil
+			}
+		}
+	}
+	if m, ok := meta["month"]; ok {
+		if t, err := time.Parse("2006-01", m); err == nil {
+			return []YearMonth{{Year: t.Year(), Month: t.Month()}}, nil
+		}
+		tried = append(tried, fmt.Sprintf("month metadata %q (invalid)", m))
+	}
+	if period := parse("file name", path.Base(file)); period != nil {
+		return period, nil
+	}
+	if fiscal != nil {
+		return fiscal, nil
 	}
-	return records, nil
+	return nil, errors.New("Cannot determine months covered; tried " + strings.Join(tried, ", "))
 }
 
-// CheckData returns whether the data has the expected columns.
-func CheckData(data Records) bool {
-	rec := data[0]
-	expected := []string{"Business Name"}
-	for d := time.Monday; d <= time.Friday; d++ {
-		expected = append(expected, d.String())
+// GetFile returns an array of bytes for `file` in `bucket`.
+func GetFile(file string, bucket blob.Store) ([]byte, error) {
+	ctx := context.Background()
+	return bucket.Get(ctx, file)
+}
+
+// readJSONConfig decodes the JSON config file `name` in the bucket into `v`,
+// leaving `v` unchanged if there is no such file.
+func readJSONConfig(bucket blob.Store, name string, v interface{}) error {
+	data, err := GetFile(name, bucket)
+	if err == blob.ErrNotExist {
+		return nil
 	}
-	for _, col := range expected {
-		if _, ok := rec[col]; !ok {
-			return false
-		}
+	if err != nil {
+		return err
 	}
-	return true
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("Invalid %s: %v", name, err)
+	}
+	return nil
+}
+
+// Records holds a slice of key/value pairs representing the records in a CSV.
+type Records = []map[string]string
+
+// CheckData returns whether the data has the expected columns: a business
+// name and Monday to Friday, under any of the names in `aliases`. Saturday
+// and Sunday columns are optional. See MapColumns.
+func CheckData(data Records, aliases ColumnAliases) bool {
+	_, err := MapColumns(data, aliases)
+	return err == nil
 }
 
 // Set holds distinct string values, e.g. a list of distinct trucks.
 type Set = map[string]bool
 
-// DailySchedule holds all stops and their trucks for a day.
-type DailySchedule = map[string][]string
+// DailySchedule holds all stops and the trucks assigned to them for a day.
+type DailySchedule = map[string][]Assignment
 
-// MonthlySchedule holds the trucks and daily schedules for a month.
-type MonthlySchedule struct {
+// Schedule holds the trucks, stops and daily schedules for a range of dates.
+type Schedule struct {
 	Trucks Set
+	Stops  Set
 	Days   map[string]DailySchedule
+	// Closed holds the dates in the range on which no trucks are scheduled
+	// because of a holiday or closure, with its name.
+	Closed Calendar
+	// Columns records which column of the data each field was taken from.
+	Columns ColumnMapping
+	// Repairs lists the rows of the data which were merged or dropped by
+	// NormalizeRows.
+	Repairs []Problem
+	// Rows holds the row of the data for each truck, for validation.
+	Rows []ScheduleRow
+}
+
+// A ScheduleRow is the row of the data for a truck, counted as by ReadCSV,
+// with its parsed cell for each day of the week in the data.
+type ScheduleRow struct {
+	Row   int
+	Truck string
+	Cells map[time.Weekday]StopCell
 }
 
-// Process returns a MonthlySchedule from data taken from a CSV.
-func Process(data Records, month time.Month, year int) (MonthlySchedule, error) {
-	if ok := CheckData(data); !ok {
-		return MonthlySchedule{}, errors.New("Data in wrong format")
+// Process returns a Schedule for each day from start to end, inclusive,
+// from data taken from a CSV, whose columns are found using `aliases`.
+// Weekend days are scheduled if the data has a column for them. Days in
+// `closed` get an empty schedule.
+func Process(data Records, aliases ColumnAliases, start time.Time, end time.Time, closed Calendar) (Schedule, error) {
+	columns, err := MapColumns(data, aliases)
+	if err != nil {
+		return Schedule{}, err
+	}
+	data, rows, repairs := NormalizeRows(columns.Apply(data), columns)
+	if end.Before(start) {
+		return Schedule{}, errors.New("End date before start date")
 	}
 
-	days := make(map[string]map[string][]string)
-	start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
-	for d := start; d.Month() == start.Month(); d = d.AddDate(0, 0, 1) {
+	days := make(map[string]DailySchedule)
+	closures := Calendar{}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
 		date := d.Format("2006-01-02")
-		days[date] = make(map[string][]string)
+		days[date] = make(DailySchedule)
+		if name, ok := closed[date]; ok {
+			closures[date] = name
+		}
 	}
 
 	trucks := make(map[string]bool)
+	stops := make(map[string]bool)
+	var scheduleRows []ScheduleRow
 
-	for _, rec := range data {
-		truck := rec["Business Name"]
+	for i, rec := range data {
+		truck := rec[FieldTruck]
 		if truck == "" {
 			continue
 		}
 		trucks[truck] = true
+		row := ScheduleRow{Row: rows[i], Truck: truck, Cells: make(map[time.Weekday]StopCell)}
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if cell, ok := rec[d.String()]; ok {
+				row.Cells[d] = ParseStopCell(cell)
+			}
+		}
+		scheduleRows = append(scheduleRows, row)
 
-		for d := start; d.Month() == start.Month(); d = d.AddDate(0, 0, 1) {
+		for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
 			date := d.Format("2006-01-02")
-			weekday := d.Weekday().String()
-			if stop, ok := rec[weekday]; ok {
-				if stop == "OFF" {
-					continue
-				}
-				if t, ok := days[date][stop]; ok {
-					days[date][stop] = append(t, truck)
-				} else {
-					days[date][stop] = []string{truck}
-				}
+			if _, ok := closures[date]; ok {
+				continue
+			}
+			// Only real stops are scheduled; a truck whose stop is
+			// unknown is left off the day.
+			for _, stop := range row.Cells[d.Weekday()].Stops {
+				stops[stop.Name] = true
+				a := Assignment{Truck: truck, Start: stop.Start, End: stop.End, Notes: strings.Join(stop.Notes, "; ")}
+				days[date][stop.Name] = append(days[date][stop.Name], a)
 			}
 		}
 	}
-	result := MonthlySchedule{
-		Trucks: trucks,
-		Days:   days,
+	result := Schedule{
+		Trucks:  trucks,
+		Stops:   stops,
+		Days:    days,
+		Closed:  closures,
+		Columns: columns,
+		Repairs: repairs,
+		Rows:    scheduleRows,
 	}
 	return result, nil
 }
@@ -175,145 +268,324 @@ func KeyName(name string) string {
 	return strings.ToLower(re.ReplaceAllString(name, ""))
 }
 
-// ID holds an ID corresponding to a name, retrieved from the database.
-type ID struct {
-	ID string `firestoreValue:"id"`
-}
-
 // GetExistingTruckIDs returns all existing truck IDs in the database.
-func GetExistingTruckIDs(ctx context.Context, client *firestore.Client) (map[string]string, error) {
-	truckIDs := make(map[string]string)
-	docs, err := client.Collection("truckNames").Documents(ctx).GetAll()
+func GetExistingTruckIDs(ctx context.Context, db DB) (map[string]string, error) {
+	truckIDs, err := db.TruckIDs(ctx)
 	if err != nil {
 		return map[string]string{}, err
 	}
-	for _, doc := range docs {
-		key := doc.Ref.ID
-		var id ID
-		err = doc.DataTo(&id)
-		if err != nil {
-			return map[string]string{}, err
-		}
-		truckIDs[key] = id.ID
-	}
 	return truckIDs, nil
 }
 
-// AddTruckID adds a new truck to the database and returns its ID.
-func AddTruckID(batch *firestore.WriteBatch, truck string, client *firestore.Client) string {
-	truckRef := client.Collection("trucks").NewDoc()
-	truckID := truckRef.ID
-	nameRef := client.Collection("truckNames").Doc(KeyName(truck))
-	batch.Set(truckRef, map[string]string{"displayName": truck})
-	batch.Set(nameRef, map[string]string{"id": truckID})
-	return truckID
-}
-
-// GetTruckIDs returns a truck's ID, creating one if it does not exist.
-func GetTruckIDs(ctx context.Context, trucks Set, client *firestore.Client) (map[string]string, error) {
-	truckIDs, err := GetExistingTruckIDs(ctx, client)
+// GetTruckIDs returns the ID of each truck, keyed by KeyName. A name which
+// is not already known is matched against the names of existing trucks:
+// if it is similar enough it is added as another name for that truck, and
+// if it might be the same truck it is held for review and has no ID.
+// Otherwise a new truck is created.
+func GetTruckIDs(ctx context.Context, trucks Set, db DB) (map[string]string, error) {
+	truckIDs, err := GetExistingTruckIDs(ctx, db)
 	if err != nil {
 		return map[string]string{}, err
 	}
-	batch := client.Batch()
-	newTrucks := 0
+	unknown := make(map[string]string)
 	for truck := range trucks {
-		if truckID, ok := truckIDs[KeyName(truck)]; !ok {
-			newTrucks = newTrucks + 1
-			truckID = AddTruckID(batch, truck, client)
-			truckIDs[KeyName(truck)] = truckID
+		if _, ok := truckIDs[KeyName(truck)]; !ok {
+			unknown[KeyName(truck)] = truck
 		}
 	}
-	if newTrucks > 0 {
-		_, err = batch.Commit(ctx)
+	if len(unknown) == 0 {
+		return truckIDs, nil
+	}
+	displayNames, err := db.TruckDisplayNames(ctx)
+	if err != nil {
+		return map[string]string{}, err
+	}
+	candidates := make(map[string][]string)
+	for id, name := range displayNames {
+		candidates[id] = append(candidates[id], name)
+	}
+	for key, id := range truckIDs {
+		candidates[id] = append(candidates[id], key)
+	}
+
+	var keys []string
+	for key := range unknown {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	aliases := make(map[string]string)
+	// New trucks are keyed by name, so that other spellings of a new truck
+	// in the same file become aliases of it.
+	added := make(map[string][]string)
+	aliasOf := make(map[string]string)
+	var newTrucks []string
+	var pending []PendingTruck
+	for _, key := range keys {
+		truck := unknown[key]
+		if m := MatchTruck(truck, added); m.Score >= TruckMatchThreshold {
+			aliasOf[key] = m.ID
+			continue
+		}
+		m := MatchTruck(truck, candidates)
+		switch {
+		case m.Score >= TruckMatchThreshold:
+			log.Printf("Adding %q as a name for truck %s %q (similarity %.2f)", truck, m.ID, m.Name, m.Score)
+			aliases[key] = m.ID
+		case m.Score >= TruckReviewThreshold:
+			log.Printf("Holding %q for review: similar to truck %s %q (similarity %.2f)", truck, m.ID, m.Name, m.Score)
+			pending = append(pending, PendingTruck{
+				Name:          truck,
+				CandidateID:   m.ID,
+				CandidateName: m.Name,
+				Score:         m.Score,
+			})
+		default:
+			newTrucks = append(newTrucks, truck)
+			added[truck] = []string{truck}
+		}
+	}
+
+	if len(newTrucks) > 0 {
+		newIDs, err := db.AddTrucks(ctx, newTrucks)
 		if err != nil {
 			return map[string]string{}, err
 		}
+		for key, truckID := range newIDs {
+			truckIDs[key] = truckID
+		}
+		for key, truck := range aliasOf {
+			aliases[key] = newIDs[KeyName(truck)]
+		}
+	}
+	if len(aliases) > 0 {
+		if err := db.AddTruckNames(ctx, aliases); err != nil {
+			return map[string]string{}, err
+		}
+		for key, truckID := range aliases {
+			truckIDs[key] = truckID
+		}
+	}
+	if len(pending) > 0 {
+		if err := db.AddPendingTrucks(ctx, pending); err != nil {
+			return map[string]string{}, err
+		}
 	}
 	return truckIDs, nil
 }
 
-// Upload uploads a dataset to the database.
-func Upload(schedule MonthlySchedule, project string, file string) error {
+// Upload uploads a dataset to the database. Only days whose schedules have
+// changed are written, and the changes are recorded with the name of the
+// file they came from, so loading the same file again changes nothing.
+//
+// What the upload is about to write is recorded in a LoadManifest first.
+// If the upload fails, its writes are rolled back; if the rollback fails
+// too, it is retried the next time the file is loaded.
+func Upload(schedule Schedule, db DB, file string) (err error) {
 	ctx := context.Background()
-	client, err := firestore.NewClient(ctx, project)
-	if err != nil {
+	if err := recoverLoad(ctx, db, file); err != nil {
 		return err
 	}
-	defer client.Close()
+	m := LoadManifest{
+		File:    file,
+		Started: time.Now(),
+		Stage:   LoadNames,
+	}
+	if err := db.SetManifest(ctx, m); err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if rbErr := rollback(ctx, db, m); rbErr != nil {
+			log.Printf("Rolling back the load of %s failed, retrying on the next load: %v", file, rbErr)
+		}
+	}()
 
-	truckIDs, err := GetTruckIDs(ctx, schedule.Trucks, client)
+	named := manifestDB{DB: db, m: &m}
+	truckIDs, err := GetTruckIDs(ctx, schedule.Trucks, named)
 	if err != nil {
 		return err
 	}
-	batch := client.Batch()
+	stopIDs, err := GetStopIDs(ctx, schedule.Stops, named)
+	if err != nil {
+		return err
+	}
+	days := make(map[string]DailySchedule)
 	for date, stops := range schedule.Days {
-		docRef := client.Collection("schedules").Doc(date)
-		data := make(map[string]map[string]map[string]bool)
-		for stop, trucks := range stops {
-			data[stop] = map[string]map[string]bool{}
-			for _, truck := range trucks {
-				truckID := truckIDs[KeyName(truck)]
-				data[stop][truckID] = map[string]bool{}
+		days[date] = DailySchedule{}
+		for stop, assignments := range stops {
+			stopID := stopIDs[StopKeyName(stop)]
+			for _, a := range assignments {
+				truckID, ok := truckIDs[KeyName(a.Truck)]
+				if !ok {
+					// The truck is awaiting review.
+					continue
+				}
+				a.Truck = truckID
+				days[date][stopID] = append(days[date][stopID], a)
 			}
 		}
-		batch.Set(docRef, data)
 	}
-	_, err = batch.Commit(ctx)
+
+	var dates []string
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	existing, err := db.GetSchedules(ctx, dates)
 	if err != nil {
 		return err
 	}
+	diffs := DiffSchedules(existing, days)
+	changed := make(map[string]DailySchedule)
+	m.Previous = make(map[string]DailySchedule)
+	for _, date := range dates {
+		day, ok := existing[date]
+		if _, diff := diffs[date]; diff || !ok {
+			changed[date] = days[date]
+			m.Dates = append(m.Dates, date)
+			if ok {
+				m.Previous[date] = day
+			}
+		}
+	}
+	log.Printf("%d of %d days changed", len(diffs), len(dates))
+	if len(changed) > 0 {
+		m.Stage = LoadSchedules
+		if err = db.SetManifest(ctx, m); err != nil {
+			return err
+		}
+		if err = db.SetSchedules(ctx, changed); err != nil {
+			return err
+		}
+	}
+	if len(diffs) > 0 {
+		err = db.AddChangeLog(ctx, ChangeLog{
+			File: file,
+			Time: time.Now(),
+			Days: diffs,
+		})
+		if err != nil {
+			return err
+		}
+	}
 
+	// Everything is written, so a failure to record that is not a failed
+	// load; at worst the next load of the file rolls it back and redoes it.
+	done := LoadManifest{File: file, Started: m.Started, Stage: LoadDone}
+	if err := db.SetManifest(ctx, done); err != nil {
+		log.Printf("Recording the load of %s as done failed: %v", file, err)
+	}
 	return nil
 }
 
-// SetFileStatus sets a file ok or not ok in the database,
-// based on whether there is an error.
-func SetFileStatus(name string, project string, status error) error {
+// SetFileStatus sets a file ok or not ok in the database, based on whether
+// there is an error. A file which is ok records the provenance `p` of the
+// data loaded from it. A file which is not ok is retried later, or
+// dead-lettered if it has failed too many times.
+func SetFileStatus(name string, db DB, p *Provenance, status error) error {
 	ctx := context.Background()
-	client, err := firestore.NewClient(ctx, project)
+	fileNoExt := strings.TrimSuffix(name, path.Ext(name))
+	s, _, err := db.GetFileStatus(ctx, fileNoExt)
 	if err != nil {
 		return err
 	}
-	defer client.Close()
-	fileNoExt := strings.TrimSuffix(name, path.Ext(name))
-	fileRef := client.Collection("dcGovFiles").Doc(fileNoExt)
-	ok := true
-	if status != nil {
-		ok = false
+	if status == nil {
+		s = s.Succeeded(p, time.Now())
+	} else {
+		s = s.Failed(StageLoad, status, time.Now())
+		if s.State == FileDead {
+			log.Printf("Giving up on %s after %d attempts: %v", name, s.Attempts, status)
+		}
 	}
-	fileRef.Set(ctx, map[string]bool{"ok": ok})
-	return nil
+	return db.SetFileStatus(ctx, fileNoExt, s)
 }
 
-// LoadDB extracts a month's data from a CSV, transforms it into one
-// observation per day, and then loads it into the database.
-func LoadDB(name string, bucket string, project string) (err error) {
-	defer func() {
-		SetFileStatus(name, project, err)
-	}()
+// MaxPeriodMonths is the most months a file may cover. The lottery results
+// are published monthly or quarterly, so a longer period, e.g. a whole
+// fiscal year, was most likely misread, and loading it would replace the
+// schedules of months the file does not cover.
+const MaxPeriodMonths = 3
+
+// LoadDB extracts the data for the months a CSV covers, transforms it into
+// one observation per day, and then loads it into the database. The file's
+// status is recorded afterwards; if that fails, LoadDB returns the error
+// unless the load itself failed.
+func LoadDB(name string, bucket blob.Store, db DB) (err error) {
 	if ext := filepath.Ext(name); ext != ".csv" {
 		return nil
 	}
-	month, year, err := GetMonthAndYear(name)
+	var provenance *Provenance
+	defer func() {
+		statusErr := SetFileStatus(name, db, provenance, err)
+		if statusErr == nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Recording the status of %s failed: %v", name, statusErr)
+			return
+		}
+		err = statusErr
+	}()
+	period, err := GetFilePeriod(name, bucket)
 	if err != nil {
 		return err
 	}
+	if len(period) > MaxPeriodMonths {
+		return fmt.Errorf("%s seems to cover %d months, from %v to %v, but files cover at most %d; "+
+			"set its month metadata or rename it", name, len(period), period[0], period[len(period)-1], MaxPeriodMonths)
+	}
+	start, end := period[0].Start(), period[len(period)-1].End()
 	file, err := GetFile(name, bucket)
 	if err != nil {
 		return err
 	}
-	data, err := ReadCSV(bytes.NewReader(file))
+	data, report, err := ReadCSV(bytes.NewReader(file))
+	for _, p := range report.Warnings {
+		log.Printf("%s: %s", name, p)
+	}
+	if err != nil {
+		return err
+	}
+	closures, err := GetClosures(bucket)
 	if err != nil {
 		return err
 	}
-	processed, err := Process(data, month, year)
+	aliases, err := GetColumnAliases(bucket)
 	if err != nil {
 		return err
 	}
-	err = Upload(processed, project, name)
+	processed, err := Process(data, aliases, start, end, NewCalendar(start, end, closures))
+	if err != nil {
+		return err
+	}
+	processed.Columns.Log(name)
+	for _, p := range processed.Repairs {
+		log.Printf("%s: %s", name, p)
+	}
+	config, err := GetValidationConfig(bucket)
+	if err != nil {
+		return err
+	}
+	stopIDs, err := db.StopIDs(context.Background())
+	if err != nil {
+		return err
+	}
+	report = Validate(processed, config, stopIDs)
+	for _, p := range report.Warnings {
+		log.Printf("%s: %s", name, p)
+	}
+	if err := report.Err(); err != nil {
+		return err
+	}
+	for date, name := range processed.Closed {
+		log.Printf("No trucks scheduled on %s: %s", date, name)
+	}
+	err = Upload(processed, db, name)
 	if err != nil {
 		return err
 	}
+	provenance = NewProvenance(GetFileMetadata(name, bucket), file, processed, start, end, time.Now())
 	return nil
 }
@@ -1,11 +1,40 @@
 package loaddb
 
 import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"foodtrucks/dcgov/blob"
 )
 
+// newTestBucket returns a bucket in a new temporary directory, and a function
+// which removes it.
+func newTestBucket(t *testing.T) (*blob.Dir, func()) {
+	root, err := ioutil.TempDir("", "loaddb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob.NewDir(root), func() { os.RemoveAll(root) }
+}
+
+// putTestFile writes `data` to the file `name` in the bucket.
+func putTestFile(t *testing.T, bucket blob.Store, name, data string) {
+	if err := bucket.Put(context.Background(), name, strings.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestGetMonthAndYear(t *testing.T) {
 	month, year, err := GetMonthAndYear("Jul 2019 foo bar")
 	if err != nil {
@@ -29,17 +58,60 @@ func TestGetMonthAndYear(t *testing.T) {
 	}
 }
 
-func TestReadCSV(t *testing.T) {
-	data := "a,b,c\n1,2,3\n4,5,6"
-	recs, err := ReadCSV(strings.NewReader(data))
+func TestGetFilePeriod(t *testing.T) {
+	root, err := ioutil.TempDir("", "loaddb")
 	if err != nil {
-		t.Fatalf("ReadCSV returned error: %v", err)
+		t.Fatal(err)
 	}
-	if len(recs) != 2 {
-		t.Fatal("ReadCSV returned the wrong number of rows")
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	bucket := blob.NewDir(root)
+	put := func(name string, meta map[string]string) {
+		if err := bucket.Put(ctx, name, strings.NewReader(""), meta); err != nil {
+			t.Fatal(err)
+		}
 	}
-	if rec := recs[0]; rec["a"] != "1" || rec["b"] != "2" || rec["c"] != "3" {
-		t.Fatal("ReadCSV returned incorrect data")
+	put("Final.pdf", map[string]string{"month": "2019-08"})
+	put("Final.csv", nil)
+	put("Results.csv", map[string]string{"linkText": "Results", "linkHeading": "Sep 2019"})
+	put("Quarter.csv", map[string]string{"linkText": "July - September 2019", "month": "2019-09"})
+	put("Oct 2019.csv", map[string]string{"linkText": "Results"})
+	put("Unknown.csv", map[string]string{"linkText": "Results"})
+	put("Monthly.csv", map[string]string{"linkText": "Results", "linkHeading": "FY20 MRV Lottery Results", "month": "2019-11"})
+	put("Titled.csv", map[string]string{"linkHeading": "FY20 MRV Lottery Results", "pdfTitle": "December 2019 Lottery"})
+	put("FY20 Q2.csv", map[string]string{"linkText": "Results"})
+
+	tests := []struct {
+		file  string
+		first YearMonth
+		n     int
+	}{
+		{"Final.csv", YearMonth{2019, time.August}, 1},
+		{"Results.csv", YearMonth{2019, time.September}, 1},
+		{"Quarter.csv", YearMonth{2019, time.July}, 3},
+		{"Oct 2019.csv", YearMonth{2019, time.October}, 1},
+		{"Nov 2019.csv", YearMonth{2019, time.November}, 1},
+		{"Monthly.csv", YearMonth{2019, time.November}, 1},
+		{"Titled.csv", YearMonth{2019, time.December}, 1},
+		{"FY20 Q2.csv", YearMonth{2020, time.January}, 3},
+	}
+	for _, test := range tests {
+		period, err := GetFilePeriod(test.file, bucket)
+		if err != nil {
+			t.Fatalf("GetFilePeriod(%q) returned error: %v", test.file, err)
+		}
+		if period[0] != test.first || len(period) != test.n {
+			t.Errorf("GetFilePeriod(%q) = %v, want %d months from %v", test.file, period, test.n, test.first)
+		}
+	}
+
+	_, err = GetFilePeriod("Unknown.csv", bucket)
+	if err == nil {
+		t.Fatal("GetFilePeriod failed to return an error")
+	}
+	if !strings.Contains(err.Error(), "linkText") || !strings.Contains(err.Error(), "file name") {
+		t.Fatalf("GetFilePeriod returned an error missing sources tried: %v", err)
 	}
 }
 
@@ -53,7 +125,7 @@ func TestCheckData(t *testing.T) {
 		"Thursday":      "foo",
 		"Friday":        "foo",
 	}
-	ok := CheckData(recs1)
+	ok := CheckData(recs1, nil)
 	if !ok {
 		t.Fatal("CheckData returned not ok on valid data")
 	}
@@ -61,8 +133,445 @@ func TestCheckData(t *testing.T) {
 	recs2 := make([]map[string]string, 2)
 	recs2[0] = map[string]string{"a": "1", "b": "2", "c": "3"}
 	recs2[1] = map[string]string{"a": "4", "b": "5", "c": "6"}
-	ok = CheckData(recs2)
+	ok = CheckData(recs2, nil)
 	if ok {
 		t.Fatal("CheckData returned ok on invalid data")
 	}
+
+	if CheckData(nil, nil) {
+		t.Fatal("CheckData returned ok on no data")
+	}
+}
+
+func TestLoadDB(t *testing.T) {
+	root, err := ioutil.TempDir("", "loaddb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	bucket := blob.NewDir(root)
+	data := "Business Name,Monday,Tuesday,Wednesday,Thursday,Friday\n" +
+		"Foo Truck,Stop A,Stop B,OFF,Stop A,Stop B\n" +
+		"Bar Truck,Stop A,OFF,Stop B,Stop B,Stop A\n"
+	meta := map[string]string{"sourceUrl": "https://dcra.dc.gov/jul2019.pdf", "sha256": "abc", "size": "1024"}
+	err = bucket.Put(ctx, "Jul 2019 - MRV Lottery Results.csv", strings.NewReader(data), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewMemoryDB()
+	err = LoadDB("Jul 2019 - MRV Lottery Results.csv", bucket, db)
+	if err != nil {
+		t.Fatalf("LoadDB returned error: %v", err)
+	}
+
+	if len(db.Trucks) != 2 {
+		t.Fatalf("LoadDB added %d trucks, want 2", len(db.Trucks))
+	}
+	foo, bar := db.TruckNames["footruck"], db.TruckNames["bartruck"]
+	if foo == "" || bar == "" {
+		t.Fatal("LoadDB did not add truck names")
+	}
+	if len(db.Schedules) != 31 {
+		t.Fatalf("LoadDB set %d days, want 31", len(db.Schedules))
+	}
+	stopA, stopB := db.StopNames["stopa"], db.StopNames["stopb"]
+	if len(db.Stops) != 2 || stopA == "" || stopB == "" {
+		t.Fatalf("LoadDB added wrong stops: %v", db.Stops)
+	}
+	// July 1, 2019 was a Monday.
+	monday := db.Schedules["2019-07-01"]
+	if len(monday[stopA]) != 2 {
+		t.Fatalf("LoadDB set wrong trucks for Monday: %v", monday)
+	}
+	tuesday := db.Schedules["2019-07-02"]
+	if len(tuesday[stopB]) != 1 || tuesday[stopB][0].Truck != foo {
+		t.Fatalf("LoadDB set wrong trucks for Tuesday: %v", tuesday)
+	}
+	status := db.Files["Jul 2019 - MRV Lottery Results"]
+	if !status.OK || status.State != FileOK {
+		t.Fatal("LoadDB did not set the file status ok")
+	}
+	p := status.Provenance
+	if p == nil || p.SourceURL != meta["sourceUrl"] || p.PDFHash != "abc" || p.PDFSize != 1024 {
+		t.Fatalf("LoadDB recorded wrong provenance: %+v", p)
+	}
+	if p.Size != int64(len(data)) || len(p.ContentHash) != 64 || p.Trucks != 2 || p.Stops != 2 {
+		t.Fatalf("LoadDB recorded wrong provenance: %+v", p)
+	}
+	if p.StartDate != "2019-07-01" || p.EndDate != "2019-07-31" || p.LoaderVersion != LoaderVersion {
+		t.Fatalf("LoadDB recorded wrong provenance: %+v", p)
+	}
+
+	// Loading again must reuse the existing truck IDs.
+	err = LoadDB("Jul 2019 - MRV Lottery Results.csv", bucket, db)
+	if err != nil {
+		t.Fatalf("LoadDB returned error: %v", err)
+	}
+	if len(db.Trucks) != 2 {
+		t.Fatal("LoadDB added duplicate trucks")
+	}
+	if len(db.Stops) != 2 {
+		t.Fatal("LoadDB added duplicate stops")
+	}
+	if len(db.ChangeLogs) != 1 || db.ChangeLogs[0].File != "Jul 2019 - MRV Lottery Results.csv" {
+		t.Fatalf("LoadDB logged changes for an unchanged file: %v", db.ChangeLogs)
+	}
+
+	// Loading a corrected file changes only the days which differ.
+	corrected := strings.Replace(data, "Bar Truck,Stop A,OFF", "Bar Truck,Stop A,Stop A", 1)
+	err = bucket.Put(ctx, "Jul 2019 - MRV Lottery Results.csv", strings.NewReader(corrected), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = LoadDB("Jul 2019 - MRV Lottery Results.csv", bucket, db)
+	if err != nil {
+		t.Fatalf("LoadDB returned error: %v", err)
+	}
+	if len(db.ChangeLogs) != 2 {
+		t.Fatalf("LoadDB logged %d changes, want 2", len(db.ChangeLogs))
+	}
+	// Bar Truck is now at Stop A on Tuesdays; July 2019 had five.
+	if days := db.ChangeLogs[1].Days; len(days) != 5 || len(days["2019-07-02"][stopA].Added) != 1 {
+		t.Fatalf("LoadDB logged the wrong changes: %v", days)
+	}
+
+	err = LoadDB("Aug 2019 - MRV Lottery Results.csv", bucket, db)
+	if err == nil {
+		t.Fatal("LoadDB failed to return an error for a missing file")
+	}
+	status, found := db.Files["Aug 2019 - MRV Lottery Results"]
+	if !found || status.OK || status.State != FileRetry || status.Stage != StageLoad || status.Attempts != 1 {
+		t.Fatalf("LoadDB did not set the file status not ok: %+v", status)
+	}
+	if status.LastError == "" || !status.NextAttempt.After(status.LastAttempt) {
+		t.Fatalf("LoadDB did not schedule a retry: %+v", status)
+	}
+
+	// Other files in the bucket, e.g. the PDF, are not loaded.
+	if err := LoadDB("Sep 2019 - MRV Lottery Results.pdf", bucket, db); err != nil {
+		t.Fatalf("LoadDB returned error for a PDF: %v", err)
+	}
+	if _, found := db.Files["Sep 2019 - MRV Lottery Results"]; found {
+		t.Fatal("LoadDB set the status of a PDF")
+	}
+}
+
+func TestLoadDBReload(t *testing.T) {
+	conn := openTestSQLite(t)
+	defer conn.Close()
+	for _, db := range []DB{NewMemoryDB(), newTestSQLiteDB(t, conn)} {
+		root, err := ioutil.TempDir("", "loaddb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+
+		ctx := context.Background()
+		bucket := blob.NewDir(root)
+		name := "Jul 2019 - MRV Lottery Results.csv"
+		files := []string{
+			"Business Name,Monday,Tuesday,Wednesday,Thursday,Friday,Saturday\n" +
+				"Foo Truck,Stop A,Stop B,OFF,Stop A,Stop B,OFF\n",
+			"Vendor,Mon,Tue,Wed,Thu,Fri\n" +
+				"Foo Truck,Stop A,Stop B,OFF,Stop A,Stop A\n",
+		}
+		for _, data := range files {
+			if err := bucket.Put(ctx, name, strings.NewReader(data), nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := LoadDB(name, bucket, db); err != nil {
+				t.Fatalf("LoadDB into %T returned error: %v", db, err)
+			}
+		}
+		want := map[string]string{
+			FieldTruck: "Vendor", "Monday": "Mon", "Tuesday": "Tue",
+			"Wednesday": "Wed", "Thursday": "Thu", "Friday": "Fri",
+		}
+		status, _, err := db.GetFileStatus(ctx, "Jul 2019 - MRV Lottery Results")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Provenance == nil || !reflect.DeepEqual(status.Provenance.Columns, want) {
+			t.Fatalf("%T recorded columns %+v after a reload, want %v", db, status.Provenance, want)
+		}
+		loaded := status.Provenance
+
+		// A failed reload keeps the provenance of the last successful one.
+		if err := bucket.Put(ctx, name, strings.NewReader("Vendor\n"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadDB(name, bucket, db); err == nil {
+			t.Fatalf("LoadDB into %T failed to return an error for a file with no days", db)
+		}
+		status, _, err = db.GetFileStatus(ctx, "Jul 2019 - MRV Lottery Results")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.OK || !reflect.DeepEqual(status.Provenance, loaded) {
+			t.Fatalf("%T recorded %+v after a failed reload, want provenance %+v", db, status, loaded)
+		}
+		// So does a status from another stage, which has no provenance.
+		status = FileStatus{}.Failed(StageConvert, fmt.Errorf("Bad PDF"), time.Now())
+		if err := db.SetFileStatus(ctx, "Jul 2019 - MRV Lottery Results", status); err != nil {
+			t.Fatal(err)
+		}
+		status, _, err = db.GetFileStatus(ctx, "Jul 2019 - MRV Lottery Results")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(status.Provenance, loaded) {
+			t.Fatalf("%T recorded provenance %+v after a status without one, want %+v", db, status.Provenance, loaded)
+		}
+	}
+}
+
+func TestLoadDBStatusError(t *testing.T) {
+	root, err := ioutil.TempDir("", "loaddb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	bucket := blob.NewDir(root)
+	data := "Business Name,Monday,Tuesday,Wednesday,Thursday,Friday\n" +
+		"Foo Truck,Stop A,Stop B,OFF,Stop A,Stop B\n"
+	err = bucket.Put(ctx, "Jul 2019 - MRV Lottery Results.csv", strings.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := NewMemoryDB()
+	db := newFaultyDB(mem, map[string]int{"SetFileStatus": 1})
+	err = LoadDB("Jul 2019 - MRV Lottery Results.csv", bucket, db)
+	if err == nil || err.Error() != "SetFileStatus failed" {
+		t.Fatalf("LoadDB returned %v, want the error recording the file status", err)
+	}
+	if len(mem.Schedules) != 31 {
+		t.Fatalf("LoadDB set %d days, want 31", len(mem.Schedules))
+	}
+}
+
+func TestLoadDBLongPeriod(t *testing.T) {
+	root, err := ioutil.TempDir("", "loaddb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	bucket := blob.NewDir(root)
+	data := "Business Name,Monday,Tuesday,Wednesday,Thursday,Friday\n" +
+		"Foo Truck,Stop A,Stop B,OFF,Stop A,Stop B\n"
+	meta := map[string]string{"linkText": "Results", "linkHeading": "FY20 MRV Lottery Results"}
+	if err := bucket.Put(ctx, "Results.csv", strings.NewReader(data), meta); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewMemoryDB()
+	err = LoadDB("Results.csv", bucket, db)
+	if err == nil || !strings.Contains(err.Error(), "12 months") {
+		t.Fatalf("LoadDB returned %v, want an error for a whole fiscal year", err)
+	}
+	if len(db.Schedules) != 0 {
+		t.Fatalf("LoadDB set %d days for a file covering a fiscal year", len(db.Schedules))
+	}
+
+	meta["month"] = "2019-11"
+	if err := bucket.Put(ctx, "Results.csv", strings.NewReader(data), meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadDB("Results.csv", bucket, db); err != nil {
+		t.Fatalf("LoadDB returned error: %v", err)
+	}
+	if len(db.Schedules) != 30 {
+		t.Fatalf("LoadDB set %d days, want 30", len(db.Schedules))
+	}
+}
+
+func TestStopKeyName(t *testing.T) {
+	tests := map[string]string{
+		"Farragut Square":    "farragutsquare",
+		"Farragut Sq.":       "farragutsquare",
+		" FARRAGUT  SQUARE ": "farragutsquare",
+		"L'Enfant Plaza":     "lenfantplaza",
+		"L'Enfant Plz":       "lenfantplaza",
+		"Union Stn":          "unionstation",
+	}
+	for input, expected := range tests {
+		if result := StopKeyName(input); result != expected {
+			t.Errorf("StopKeyName(%q) = %q, want %q", input, result, expected)
+		}
+	}
+}
+
+// TestStopAbbreviationsMatch checks that the copy of stopAbbreviations used
+// to upload the stops registry, which is in another module, is the same as
+// this one, so that both give a stop the same key.
+func TestStopAbbreviationsMatch(t *testing.T) {
+	file := filepath.Join("..", "..", "..", "db", "stops", "stops.go")
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := f.Scope.Lookup("stopAbbreviations")
+	if obj == nil {
+		t.Fatalf("%s has no stopAbbreviations", file)
+	}
+	lit, ok := obj.Decl.(*ast.ValueSpec).Values[0].(*ast.CompositeLit)
+	if !ok {
+		t.Fatalf("stopAbbreviations in %s is not a map literal", file)
+	}
+	other := make(map[string]string)
+	for _, elt := range lit.Elts {
+		kv := elt.(*ast.KeyValueExpr)
+		k, err1 := strconv.Unquote(kv.Key.(*ast.BasicLit).Value)
+		v, err2 := strconv.Unquote(kv.Value.(*ast.BasicLit).Value)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("stopAbbreviations in %s has an entry which is not two strings", file)
+		}
+		other[k] = v
+	}
+	if !reflect.DeepEqual(other, stopAbbreviations) {
+		t.Fatalf("stopAbbreviations in %s = %v, want %v", file, other, stopAbbreviations)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	data := Records{
+		{"Business Name": "Foo", "Monday": "A", "Tuesday": "B", "Wednesday": "OFF", "Thursday": "A", "Friday": "B"},
+		{"Business Name": "", "Monday": "", "Tuesday": "", "Wednesday": "", "Thursday": "", "Friday": ""},
+	}
+	start := time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, time.September, 30, 0, 0, 0, 0, time.UTC)
+	schedule, err := Process(data, nil, start, end, Calendar{"2019-07-04": "Independence Day"})
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+	if len(schedule.Days) != 92 {
+		t.Fatalf("Process returned %d days, want 92", len(schedule.Days))
+	}
+	if len(schedule.Trucks) != 1 || !schedule.Trucks["Foo"] {
+		t.Fatalf("Process returned wrong trucks: %v", schedule.Trucks)
+	}
+	// September 30, 2019 was a Monday.
+	if trucks := schedule.Days["2019-09-30"]["A"]; len(trucks) != 1 || trucks[0].Truck != "Foo" {
+		t.Fatalf("Process returned wrong schedule for the last day: %v", schedule.Days["2019-09-30"])
+	}
+	if len(schedule.Days["2019-07-03"]) != 0 || len(schedule.Days["2019-07-06"]) != 0 {
+		t.Fatal("Process scheduled a truck on a day off or weekend")
+	}
+	if len(schedule.Days["2019-07-04"]) != 0 || schedule.Closed["2019-07-04"] != "Independence Day" {
+		t.Fatal("Process scheduled a truck on a holiday")
+	}
+	if len(schedule.Closed) != 1 {
+		t.Fatalf("Process returned wrong closures: %v", schedule.Closed)
+	}
+
+	if _, err := Process(data, nil, end, start, nil); err == nil {
+		t.Fatal("Process failed to return an error for an end before the start")
+	}
+}
+
+func TestProcessWeekendsAndTimes(t *testing.T) {
+	data := Records{
+		{"Business Name": "Foo", "Monday": "A (11am-2pm)", "Tuesday": "OFF", "Wednesday": "OFF",
+			"Thursday": "OFF", "Friday": "B 5-9pm", "Saturday": "C", "Sunday": ""},
+	}
+	// July 1, 2019 was a Monday.
+	start := time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, time.July, 7, 0, 0, 0, 0, time.UTC)
+	schedule, err := Process(data, nil, start, end, nil)
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+	want := map[string]DailySchedule{
+		"2019-07-01": {"A": {{Truck: "Foo", Start: "11:00", End: "14:00"}}},
+		"2019-07-05": {"B": {{Truck: "Foo", Start: "17:00", End: "21:00"}}},
+		"2019-07-06": {"C": {{Truck: "Foo"}}},
+		"2019-07-07": {},
+	}
+	for date, day := range want {
+		if fmt.Sprint(schedule.Days[date]) != fmt.Sprint(day) {
+			t.Errorf("Process returned %v on %s, want %v", schedule.Days[date], date, day)
+		}
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		cell, stop, start, end string
+	}{
+		{"Farragut Square", "Farragut Square", "", ""},
+		{"Farragut Square 17th St", "Farragut Square 17th St", "", ""},
+		{"Navy Yard (11am-2pm)", "Navy Yard", "11:00", "14:00"},
+		{"Navy Yard, 5-9pm", "Navy Yard", "17:00", "21:00"},
+		{"Navy Yard 11:30 - 14:00", "Navy Yard", "11:30", "14:00"},
+		{"Navy Yard 11 to 2:30", "Navy Yard", "11:00", "14:30"},
+		{"Navy Yard 11 to 2", "Navy Yard 11 to 2", "", ""},
+		{"Route 1 - 7", "Route 1 - 7", "", ""},
+		{"Navy Yard (10:30 a.m. - 2 p.m.)", "Navy Yard", "10:30", "14:00"},
+		{"Navy Yard 12pm-12am", "Navy Yard 12pm-12am", "", ""},
+		{"11am-2pm", "11am-2pm", "", ""},
+	}
+	for _, test := range tests {
+		stop, start, end := ParseTimeWindow(test.cell)
+		if stop != test.stop || start != test.start || end != test.end {
+			t.Errorf("ParseTimeWindow(%q) = %q, %q, %q, want %q, %q, %q",
+				test.cell, stop, start, end, test.stop, test.start, test.end)
+		}
+	}
+}
+
+func TestScheduleDoc(t *testing.T) {
+	day := DailySchedule{
+		"A": {{Truck: "foo"}, {Truck: "bar", Start: "11:00", End: "14:00"}},
+		"B": {
+			{Truck: "bar", Start: "17:00", End: "21:00"},
+			{Truck: "bar", Start: "11:00", End: "14:00", Notes: "*"},
+			{Truck: "bar", Start: "11:00", End: "14:00"},
+		},
+		"C": {{Truck: "foo", Start: "11:00", End: "14:00"}, {Truck: "foo", Notes: "*"}},
+	}
+	doc := scheduleDoc(day)
+	want := map[string]map[string]truckDoc{
+		"A": {
+			"foo": {Windows: []windowDoc{{}}},
+			"bar": {Windows: []windowDoc{{Start: "11:00", End: "14:00"}}},
+		},
+		// Lunch and dinner are kept apart.
+		"B": {"bar": {Windows: []windowDoc{
+			{Start: "11:00", End: "14:00", Notes: "*"},
+			{Start: "17:00", End: "21:00"},
+		}}},
+		"C": {"foo": {Windows: []windowDoc{{Notes: "*"}}}},
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Fatalf("scheduleDoc = %v, want %v", doc, want)
+	}
+
+	// Documents read back from Firestore hold generic maps and slices.
+	generic := map[string]interface{}{
+		"B": map[string]interface{}{"bar": map[string]interface{}{"windows": []interface{}{
+			map[string]interface{}{"start": "11:00", "end": "14:00", "notes": "*"},
+			map[string]interface{}{"start": "17:00", "end": "21:00"},
+		}}},
+		// Older documents have one window, or none, for each truck.
+		"D": map[string]interface{}{
+			"foo": map[string]interface{}{},
+			"bar": map[string]interface{}{"start": "11:00", "end": "14:00"},
+		},
+	}
+	got := scheduleFromDoc(generic)
+	sortAssignments(got["D"])
+	wantDay := DailySchedule{
+		"B": {{Truck: "bar", Start: "11:00", End: "14:00", Notes: "*"}, {Truck: "bar", Start: "17:00", End: "21:00"}},
+		"D": {{Truck: "bar", Start: "11:00", End: "14:00"}, {Truck: "foo"}},
+	}
+	if !reflect.DeepEqual(got, wantDay) {
+		t.Fatalf("scheduleFromDoc = %v, want %v", got, wantDay)
+	}
 }
@@ -0,0 +1,205 @@
+package loaddb
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// The stages of a load, recorded in its manifest. A load in any stage but
+// LoadDone or LoadRolledBack did not finish and must be rolled back.
+const (
+	// LoadNames is the stage in which new truck and stop names are added.
+	LoadNames = "names"
+	// LoadSchedules is the stage in which schedules and the change log are
+	// written.
+	LoadSchedules = "schedules"
+	// LoadDone means the load finished.
+	LoadDone = "done"
+	// LoadRolledBack means the load failed and its writes were undone.
+	LoadRolledBack = "rolledBack"
+)
+
+// A LoadManifest records what a load of a file is about to write, before it
+// writes it, so that if the load fails part way its writes can be undone,
+// even by a later run.
+type LoadManifest struct {
+	File    string    `firestore:"file"`
+	Started time.Time `firestore:"started"`
+	Stage   string    `firestore:"stage"`
+	// TruckIDs and StopIDs are the IDs of the trucks and stops which the
+	// load added, and TruckNames and StopNames map the key names it added
+	// to their IDs. Trucks and stops added at the same time by a load of
+	// another file are not in them, so are not rolled back with this load.
+	TruckIDs   []string          `firestore:"truckIds"`
+	TruckNames map[string]string `firestore:"truckNames"`
+	StopIDs    []string          `firestore:"stopIds"`
+	StopNames  map[string]string `firestore:"stopNames"`
+	// Dates are the days whose schedules the load writes, and Previous
+	// holds the schedules they had before, if any.
+	Dates    []string                 `firestore:"dates"`
+	Previous map[string]DailySchedule `firestore:"-"`
+}
+
+// manifestDB is a DB which records the trucks, stops and names a load adds
+// in the load's manifest, and saves the manifest, as soon as they are added.
+// IDs are only known once they are added, so if the load stops in between
+// they are left in the database, where the next load of the file uses them.
+type manifestDB struct {
+	DB
+	m *LoadManifest
+}
+
+// withNames returns a copy of `names` with `added` added to it.
+func withNames(names map[string]string, added map[string]string) map[string]string {
+	result := make(map[string]string)
+	for key, id := range names {
+		result[key] = id
+	}
+	for key, id := range added {
+		result[key] = id
+	}
+	return result
+}
+
+// sortedIDs returns the distinct values of `ids`, sorted.
+func sortedIDs(ids map[string]string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (db manifestDB) AddTrucks(ctx context.Context, names []string) (map[string]string, error) {
+	truckIDs, err := db.DB.AddTrucks(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	db.m.TruckIDs = append(db.m.TruckIDs, sortedIDs(truckIDs)...)
+	db.m.TruckNames = withNames(db.m.TruckNames, truckIDs)
+	return truckIDs, db.DB.SetManifest(ctx, *db.m)
+}
+
+func (db manifestDB) AddTruckNames(ctx context.Context, names map[string]string) error {
+	if err := db.DB.AddTruckNames(ctx, names); err != nil {
+		return err
+	}
+	db.m.TruckNames = withNames(db.m.TruckNames, names)
+	return db.DB.SetManifest(ctx, *db.m)
+}
+
+func (db manifestDB) AddStops(ctx context.Context, names []string) (map[string]string, error) {
+	stopIDs, err := db.DB.AddStops(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	db.m.StopIDs = append(db.m.StopIDs, sortedIDs(stopIDs)...)
+	db.m.StopNames = withNames(db.m.StopNames, stopIDs)
+	return stopIDs, db.DB.SetManifest(ctx, *db.m)
+}
+
+// addedByLoad returns which of `names`, the key names a load added mapped
+// to their IDs, still have those IDs in `current`, which maps all key names
+// to IDs, and which of `ids`, the IDs the load added, no other name refers
+// to. So names and IDs which another load has since taken over are kept.
+func addedByLoad(current map[string]string, names map[string]string, ids []string) ([]string, []string) {
+	var own []string
+	for key, id := range names {
+		if current[key] == id {
+			own = append(own, key)
+		}
+	}
+	sort.Strings(own)
+	isOwn := make(map[string]bool)
+	for _, key := range own {
+		isOwn[key] = true
+	}
+	shared := make(map[string]bool)
+	for key, id := range current {
+		if !isOwn[key] {
+			shared[id] = true
+		}
+	}
+	var added []string
+	for _, id := range ids {
+		if !shared[id] {
+			added = append(added, id)
+		}
+	}
+	return own, added
+}
+
+// rollback undoes the writes made by the load in manifest `m`: schedules
+// are restored to what they were before, and the trucks, stops and names
+// it added are deleted. Trucks held for review are left for review.
+func rollback(ctx context.Context, db DB, m LoadManifest) error {
+	if len(m.Dates) > 0 {
+		restore := make(map[string]DailySchedule)
+		var missing []string
+		for _, date := range m.Dates {
+			if day, ok := m.Previous[date]; ok {
+				restore[date] = day
+			} else {
+				missing = append(missing, date)
+			}
+		}
+		if len(restore) > 0 {
+			if err := db.SetSchedules(ctx, restore); err != nil {
+				return err
+			}
+		}
+		if len(missing) > 0 {
+			if err := db.DeleteSchedules(ctx, missing); err != nil {
+				return err
+			}
+		}
+	}
+
+	truckIDs, err := db.TruckIDs(ctx)
+	if err != nil {
+		return err
+	}
+	if names, added := addedByLoad(truckIDs, m.TruckNames, m.TruckIDs); len(names) > 0 || len(added) > 0 {
+		if err := db.DeleteTrucks(ctx, added, names); err != nil {
+			return err
+		}
+	}
+	stopIDs, err := db.StopIDs(ctx)
+	if err != nil {
+		return err
+	}
+	if names, added := addedByLoad(stopIDs, m.StopNames, m.StopIDs); len(names) > 0 || len(added) > 0 {
+		if err := db.DeleteStops(ctx, added, names); err != nil {
+			return err
+		}
+	}
+
+	m.Stage = LoadRolledBack
+	return db.SetManifest(ctx, m)
+}
+
+// recoverLoad rolls back the last load of `file` if it did not finish, e.g.
+// because the function timed out, or its own rollback failed.
+func recoverLoad(ctx context.Context, db DB, file string) error {
+	m, ok, err := db.GetManifest(ctx, file)
+	if err != nil || !ok {
+		return err
+	}
+	if m.Stage == LoadDone || m.Stage == LoadRolledBack {
+		return nil
+	}
+	log.Printf("Rolling back unfinished load of %s started %s", file, m.Started.Format(time.RFC3339))
+	return rollback(ctx, db, m)
+}
+
+// RollbackLoad undoes the last load of `file` if it did not finish.
+func RollbackLoad(file string, db DB) error {
+	return recoverLoad(context.Background(), db, file)
+}
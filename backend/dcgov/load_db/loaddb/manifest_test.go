@@ -0,0 +1,244 @@
+package loaddb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// faultyDB is a DB which fails the nth call to a method, to test that a
+// load which fails between steps is rolled back.
+type faultyDB struct {
+	DB
+	// fail maps method names to the call which fails, counting from 1.
+	fail  map[string]int
+	calls map[string]int
+	// before, if set, is called at each call, before it runs, e.g. to run
+	// a load of another file part way through this one.
+	before func(method string)
+}
+
+func newFaultyDB(db DB, fail map[string]int) *faultyDB {
+	return &faultyDB{DB: db, fail: fail, calls: make(map[string]int)}
+}
+
+func (db *faultyDB) inject(method string) error {
+	db.calls[method]++
+	if db.before != nil {
+		db.before(method)
+	}
+	if db.calls[method] == db.fail[method] {
+		return errors.New(method + " failed")
+	}
+	return nil
+}
+
+func (db *faultyDB) AddTrucks(ctx context.Context, names []string) (map[string]string, error) {
+	if err := db.inject("AddTrucks"); err != nil {
+		return nil, err
+	}
+	return db.DB.AddTrucks(ctx, names)
+}
+
+func (db *faultyDB) AddStops(ctx context.Context, names []string) (map[string]string, error) {
+	if err := db.inject("AddStops"); err != nil {
+		return nil, err
+	}
+	return db.DB.AddStops(ctx, names)
+}
+
+func (db *faultyDB) SetSchedules(ctx context.Context, days map[string]DailySchedule) error {
+	if err := db.inject("SetSchedules"); err != nil {
+		return err
+	}
+	return db.DB.SetSchedules(ctx, days)
+}
+
+func (db *faultyDB) AddChangeLog(ctx context.Context, log ChangeLog) error {
+	if err := db.inject("AddChangeLog"); err != nil {
+		return err
+	}
+	return db.DB.AddChangeLog(ctx, log)
+}
+
+func (db *faultyDB) SetFileStatus(ctx context.Context, file string, status FileStatus) error {
+	if err := db.inject("SetFileStatus"); err != nil {
+		return err
+	}
+	return db.DB.SetFileStatus(ctx, file, status)
+}
+
+func (db *faultyDB) SetManifest(ctx context.Context, m LoadManifest) error {
+	if err := db.inject("SetManifest"); err != nil {
+		return err
+	}
+	return db.DB.SetManifest(ctx, m)
+}
+
+// snapshot holds the data a load changes.
+type snapshot struct {
+	Trucks, TruckNames, Stops, StopNames map[string]string
+	Schedules                            map[string]DailySchedule
+}
+
+func takeSnapshot(db *MemoryDB) snapshot {
+	copyMap := func(m map[string]string) map[string]string {
+		c := make(map[string]string)
+		for k, v := range m {
+			c[k] = v
+		}
+		return c
+	}
+	schedules := make(map[string]DailySchedule)
+	for date, day := range db.Schedules {
+		schedules[date] = DailySchedule{}
+		for stop, assignments := range day {
+			schedules[date][stop] = append([]Assignment(nil), assignments...)
+		}
+	}
+	return snapshot{
+		Trucks:     copyMap(db.Trucks),
+		TruckNames: copyMap(db.TruckNames),
+		Stops:      copyMap(db.Stops),
+		StopNames:  copyMap(db.StopNames),
+		Schedules:  schedules,
+	}
+}
+
+var (
+	firstSchedule = Schedule{
+		Trucks: Set{"Foo Truck": true, "Bar Truck": true},
+		Stops:  Set{"Stop A": true},
+		Days: map[string]DailySchedule{
+			"2019-07-01": {"Stop A": {{Truck: "Foo Truck"}, {Truck: "Bar Truck"}}},
+			"2019-07-02": {"Stop A": {{Truck: "Foo Truck"}}},
+		},
+	}
+	// secondSchedule adds a truck and a stop and changes one day.
+	secondSchedule = Schedule{
+		Trucks: Set{"Foo Truck": true, "Bar Truck": true, "Pho Wheels": true},
+		Stops:  Set{"Stop A": true, "Stop B": true},
+		Days: map[string]DailySchedule{
+			"2019-07-01": {"Stop A": {{Truck: "Foo Truck"}, {Truck: "Bar Truck"}}},
+			"2019-07-02": {"Stop A": {{Truck: "Foo Truck"}}, "Stop B": {{Truck: "Pho Wheels"}}},
+			"2019-07-03": {"Stop B": {{Truck: "Bar Truck"}}},
+		},
+	}
+)
+
+func TestUploadRollback(t *testing.T) {
+	steps := []string{"AddTrucks", "AddStops", "SetSchedules", "AddChangeLog"}
+	for _, step := range steps {
+		mem := NewMemoryDB()
+		if err := Upload(firstSchedule, mem, "july.csv"); err != nil {
+			t.Fatalf("Upload returned error: %v", err)
+		}
+		before := takeSnapshot(mem)
+
+		db := newFaultyDB(mem, map[string]int{step: 1})
+		if err := Upload(secondSchedule, db, "july.csv"); err == nil {
+			t.Fatalf("Upload did not return an error when %s failed", step)
+		}
+		if after := takeSnapshot(mem); !reflect.DeepEqual(before, after) {
+			t.Fatalf("Upload did not roll back when %s failed:\nbefore %v\nafter  %v", step, before, after)
+		}
+		if stage := mem.Manifests["july.csv"].Stage; stage != LoadRolledBack {
+			t.Fatalf("Upload left the manifest in stage %q when %s failed", stage, step)
+		}
+
+		if err := Upload(secondSchedule, mem, "july.csv"); err != nil {
+			t.Fatalf("Upload returned error: %v", err)
+		}
+		if len(mem.Trucks) != 3 || len(mem.Stops) != 2 || len(mem.Schedules) != 3 {
+			t.Fatalf("Upload after %s failed loaded %d trucks, %d stops and %d days, want 3, 2 and 3",
+				step, len(mem.Trucks), len(mem.Stops), len(mem.Schedules))
+		}
+		if stage := mem.Manifests["july.csv"].Stage; stage != LoadDone {
+			t.Fatalf("Upload left the manifest in stage %q", stage)
+		}
+	}
+}
+
+func TestUploadRollbackConcurrent(t *testing.T) {
+	mem := NewMemoryDB()
+	july := Schedule{
+		Trucks: Set{"Foo Truck": true, "Pho Wheels": true},
+		Stops:  Set{"Stop A": true, "Stop B": true},
+		Days: map[string]DailySchedule{
+			"2019-07-01": {"Stop A": {{Truck: "Foo Truck"}}, "Stop B": {{Truck: "Pho Wheels"}}},
+		},
+	}
+	august := Schedule{
+		Trucks: Set{"Pho Wheels": true},
+		Stops:  Set{"Stop B": true},
+		Days: map[string]DailySchedule{
+			"2019-08-01": {"Stop B": {{Truck: "Pho Wheels"}}},
+		},
+	}
+
+	// August is loaded after the load of July starts, and adds a truck and
+	// a stop which July would have added. Rolling back July must keep them.
+	db := newFaultyDB(mem, map[string]int{"SetSchedules": 1})
+	db.before = func(method string) {
+		if method == "SetManifest" && db.calls[method] == 1 {
+			if err := Upload(august, mem, "august.csv"); err != nil {
+				t.Fatalf("Upload returned error: %v", err)
+			}
+		}
+	}
+	if err := Upload(july, db, "july.csv"); err == nil {
+		t.Fatal("Upload did not return an error")
+	}
+	if len(mem.Trucks) != 1 || len(mem.Stops) != 1 {
+		t.Fatalf("Upload left %d trucks and %d stops, want 1 and 1", len(mem.Trucks), len(mem.Stops))
+	}
+	truckID, ok1 := mem.TruckNames["phowheels"]
+	stopID, ok2 := mem.StopNames["stopb"]
+	if !ok1 || !ok2 || mem.Trucks[truckID] == "" || mem.Stops[stopID] == "" {
+		t.Fatalf("Upload rolled back the trucks and stops of another load: %v %v", mem.TruckNames, mem.StopNames)
+	}
+	if _, ok := mem.Schedules["2019-08-01"]; !ok || len(mem.Schedules) != 1 {
+		t.Fatalf("Upload left schedules %v, want only 2019-08-01", mem.Schedules)
+	}
+}
+
+func TestUploadRecover(t *testing.T) {
+	mem := NewMemoryDB()
+	if err := Upload(firstSchedule, mem, "july.csv"); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	before := takeSnapshot(mem)
+
+	// The change log fails, and then so does the rollback, e.g. because the
+	// function timed out, leaving the new truck and schedules behind.
+	db := newFaultyDB(mem, map[string]int{"AddChangeLog": 1, "SetSchedules": 2})
+	if err := Upload(secondSchedule, db, "july.csv"); err == nil {
+		t.Fatal("Upload did not return an error")
+	}
+	if stage := mem.Manifests["july.csv"].Stage; stage != LoadSchedules {
+		t.Fatalf("Upload left the manifest in stage %q, want %q", stage, LoadSchedules)
+	}
+	if _, ok := mem.TruckNames["phowheels"]; !ok {
+		t.Fatal("Upload rolled back although the rollback failed")
+	}
+
+	if err := RollbackLoad("july.csv", mem); err != nil {
+		t.Fatalf("RollbackLoad returned error: %v", err)
+	}
+	if after := takeSnapshot(mem); !reflect.DeepEqual(before, after) {
+		t.Fatalf("RollbackLoad did not roll back:\nbefore %v\nafter  %v", before, after)
+	}
+
+	// The next load of the file rolls back an unfinished load first.
+	db = newFaultyDB(mem, map[string]int{"AddChangeLog": 1, "SetSchedules": 2})
+	if err := Upload(secondSchedule, db, "july.csv"); err == nil {
+		t.Fatal("Upload did not return an error")
+	}
+	if err := Upload(secondSchedule, mem, "july.csv"); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+	if len(mem.Trucks) != 3 || len(mem.TruckNames) != 3 {
+		t.Fatalf("Upload left %d trucks and %d names, want 3 and 3", len(mem.Trucks), len(mem.TruckNames))
+	}
+}
@@ -0,0 +1,178 @@
+package loaddb
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// TruckMatchThreshold is the similarity above which an unknown truck
+	// name is taken to be another name for an existing truck.
+	TruckMatchThreshold = 0.85
+	// TruckReviewThreshold is the similarity above which an unknown truck
+	// name may be another name for an existing truck, so it is held for a
+	// maintainer to review rather than added as a new truck.
+	TruckReviewThreshold = 0.6
+)
+
+// truckNameStopWords are words which do not help tell trucks apart, e.g.
+// business entity suffixes such as "LLC".
+var truckNameStopWords = map[string]bool{
+	"llc":          true,
+	"inc":          true,
+	"incorporated": true,
+	"co":           true,
+	"corp":         true,
+	"corporation":  true,
+	"company":      true,
+	"ltd":          true,
+	"dba":          true,
+	"the":          true,
+	"truck":        true,
+	"trucks":       true,
+}
+
+var truckWordRe = regexp.MustCompile(`[a-z0-9]+`)
+
+// truckTokens returns the words in a truck name which help identify it,
+// lowercased and without punctuation. Apostrophes are removed rather than
+// splitting words, so "Fojol's" is one word.
+func truckTokens(name string) []string {
+	name = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(name))
+	var tokens []string
+	for _, w := range truckWordRe.FindAllString(name, -1) {
+		if !truckNameStopWords[w] {
+			tokens = append(tokens, w)
+		}
+	}
+	return tokens
+}
+
+// NormalizeTruckName returns a truck name in a canonical form for
+// comparison: lowercase words without punctuation or business entity
+// suffixes, separated by single spaces. e.g. "Abstrak Cuisine, LLC" ->
+// "abstrak cuisine".
+func NormalizeTruckName(name string) string {
+	return strings.Join(truckTokens(name), " ")
+}
+
+// levenshtein returns the number of single character insertions, deletions
+// and substitutions needed to turn a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// editSimilarity returns the similarity of two token lists from 0 to 1
+// based on the edit distance between them, ignoring spaces.
+func editSimilarity(a, b []string) float64 {
+	ra := []rune(strings.Join(a, ""))
+	rb := []rune(strings.Join(b, ""))
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// tokenSetSimilarity returns the number of distinct tokens two token lists
+// share divided by the number of distinct tokens in either, so that word
+// order does not matter.
+func tokenSetSimilarity(a, b []string) float64 {
+	union := make(map[string]int)
+	for _, t := range a {
+		union[t] |= 1
+	}
+	for _, t := range b {
+		union[t] |= 2
+	}
+	if len(union) == 0 {
+		return 0
+	}
+	shared := 0
+	for _, in := range union {
+		if in == 3 {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(union))
+}
+
+// TruckNameSimilarity returns how likely two names are to be the same truck,
+// from 0 to 1. It is the greater of their edit distance and token set
+// similarities after normalization, so it tolerates both typos and
+// reordered words.
+func TruckNameSimilarity(a, b string) float64 {
+	ta, tb := truckTokens(a), truckTokens(b)
+	edit := editSimilarity(ta, tb)
+	if set := tokenSetSimilarity(ta, tb); set > edit {
+		return set
+	}
+	return edit
+}
+
+// A TruckMatch is the existing truck most similar to a name.
+type TruckMatch struct {
+	ID    string
+	Name  string
+	Score float64
+}
+
+// MatchTruck returns the truck in `candidates`, which maps truck IDs to
+// their names, whose names are most similar to `name`. Ties are broken by
+// ID so the result does not depend on map order.
+func MatchTruck(name string, candidates map[string][]string) TruckMatch {
+	var ids []string
+	for id := range candidates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var best TruckMatch
+	for _, id := range ids {
+		for _, candidate := range candidates[id] {
+			if score := TruckNameSimilarity(name, candidate); score > best.Score {
+				best = TruckMatch{ID: id, Name: candidate, Score: score}
+			}
+		}
+	}
+	return best
+}
+
+// A PendingTruck is a truck name which may be another name for an existing
+// truck, held for a maintainer to either add as an alias of the candidate
+// truck or add as a new truck.
+type PendingTruck struct {
+	Name          string  `firestore:"name"`
+	CandidateID   string  `firestore:"candidateId"`
+	CandidateName string  `firestore:"candidateName"`
+	Score         float64 `firestore:"score"`
+}
@@ -0,0 +1,99 @@
+package loaddb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormalizeTruckName(t *testing.T) {
+	tests := map[string]string{
+		"Abstrak Cuisine, LLC":   "abstrak cuisine",
+		"Abunai LLC":             "abunai",
+		"  FOJOL'S  Bros. Inc. ": "fojols bros",
+		"The Big Cheese Truck":   "big cheese",
+		"#222":                   "222",
+	}
+	for input, expected := range tests {
+		if result := NormalizeTruckName(input); result != expected {
+			t.Errorf("NormalizeTruckName(%q) = %q, want %q", input, result, expected)
+		}
+	}
+}
+
+func TestTruckNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		match bool
+		min   float64
+		max   float64
+	}{
+		{"Abstrak Cuisine, LLC", "Abstrak Cuisine", true, 1, 1},
+		{"Abstrack Cuisine", "Abstrak Cuisine", true, 0.9, 1},
+		{"Cuisine Abstrak", "Abstrak Cuisine", true, 1, 1},
+		{"Big Cheese Burgers", "Big Cheese", false, 0.6, 0.7},
+		{"Foo Truck", "Bar Truck", false, 0, 0.1},
+	}
+	for _, test := range tests {
+		score := TruckNameSimilarity(test.a, test.b)
+		if score < test.min || score > test.max {
+			t.Errorf("TruckNameSimilarity(%q, %q) = %.2f, want %.2f to %.2f", test.a, test.b, score, test.min, test.max)
+		}
+		if match := score >= TruckMatchThreshold; match != test.match {
+			t.Errorf("TruckNameSimilarity(%q, %q) = %.2f, want match %v", test.a, test.b, score, test.match)
+		}
+	}
+}
+
+func TestGetTruckIDs(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	existing, err := db.AddTrucks(ctx, []string{"Abstrak Cuisine", "Big Cheese"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	abstrak, cheese := existing["abstrakcuisine"], existing["bigcheese"]
+
+	trucks := Set{
+		"Abstrak Cuisine":      true,
+		"Abstrack Cuisine LLC": true,
+		"Big Cheese Burgers":   true,
+		"Pho Wheels":           true,
+		"Pho Wheels, Inc.":     true,
+	}
+	truckIDs, err := GetTruckIDs(ctx, trucks, db)
+	if err != nil {
+		t.Fatalf("GetTruckIDs returned error: %v", err)
+	}
+	if truckIDs["abstrakcuisine"] != abstrak || truckIDs["abstrackcuisinellc"] != abstrak {
+		t.Errorf("GetTruckIDs did not link a misspelled name: %v", truckIDs)
+	}
+	if db.TruckNames["abstrackcuisinellc"] != abstrak {
+		t.Error("GetTruckIDs did not save the new name")
+	}
+	if _, ok := truckIDs["bigcheeseburgers"]; ok {
+		t.Error("GetTruckIDs returned an ID for a truck awaiting review")
+	}
+	pending, ok := db.PendingTrucks["bigcheeseburgers"]
+	if !ok || pending.CandidateID != cheese {
+		t.Errorf("GetTruckIDs did not hold a similar name for review: %v", db.PendingTrucks)
+	}
+	pho := truckIDs["phowheels"]
+	if pho == "" || truckIDs["phowheelsinc"] != pho {
+		t.Errorf("GetTruckIDs did not add one new truck for both names: %v", truckIDs)
+	}
+	if len(db.Trucks) != 3 {
+		t.Errorf("GetTruckIDs left %d trucks, want 3", len(db.Trucks))
+	}
+
+	// Once reviewed and added as a name, the pending name is resolved.
+	if err := db.AddTruckNames(ctx, map[string]string{"bigcheeseburgers": cheese}); err != nil {
+		t.Fatal(err)
+	}
+	truckIDs, err = GetTruckIDs(ctx, trucks, db)
+	if err != nil {
+		t.Fatalf("GetTruckIDs returned error: %v", err)
+	}
+	if truckIDs["bigcheeseburgers"] != cheese || len(db.PendingTrucks) != 0 {
+		t.Errorf("GetTruckIDs did not use the reviewed name: %v", truckIDs)
+	}
+}
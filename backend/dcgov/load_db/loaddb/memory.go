@@ -0,0 +1,240 @@
+package loaddb
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// MemoryDB is a DB that keeps all data in memory, for tests and local runs.
+type MemoryDB struct {
+	mu sync.Mutex
+	// Trucks maps truck IDs to display names.
+	Trucks map[string]string
+	// TruckNames maps truck key names to truck IDs.
+	TruckNames map[string]string
+	// PendingTrucks maps the key names of truck names awaiting review to
+	// the most similar existing truck.
+	PendingTrucks map[string]PendingTruck
+	// Stops maps stop IDs to display names.
+	Stops map[string]string
+	// StopNames maps stop key names to stop IDs.
+	StopNames map[string]string
+	// Schedules maps dates to the truck IDs assigned to each stop ID.
+	Schedules map[string]DailySchedule
+	// ChangeLogs holds the changes made by each load, in order.
+	ChangeLogs []ChangeLog
+	// Manifests maps file names to the manifest of their last load.
+	Manifests map[string]LoadManifest
+	// Files maps file names to their processing status.
+	Files map[string]FileStatus
+}
+
+// NewMemoryDB returns an empty MemoryDB.
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		Trucks:        make(map[string]string),
+		TruckNames:    make(map[string]string),
+		PendingTrucks: make(map[string]PendingTruck),
+		Stops:         make(map[string]string),
+		StopNames:     make(map[string]string),
+		Schedules:     make(map[string]DailySchedule),
+		Manifests:     make(map[string]LoadManifest),
+		Files:         make(map[string]FileStatus),
+	}
+}
+
+// TruckIDs returns all existing truck IDs in the database.
+func (db *MemoryDB) TruckIDs(ctx context.Context) (map[string]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	truckIDs := make(map[string]string)
+	for key, id := range db.TruckNames {
+		truckIDs[key] = id
+	}
+	return truckIDs, nil
+}
+
+// TruckDisplayNames returns the display name of each truck in the database.
+func (db *MemoryDB) TruckDisplayNames(ctx context.Context) (map[string]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	trucks := make(map[string]string)
+	for id, name := range db.Trucks {
+		trucks[id] = name
+	}
+	return trucks, nil
+}
+
+// AddTrucks adds new trucks to the database and returns their IDs.
+func (db *MemoryDB) AddTrucks(ctx context.Context, names []string) (map[string]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	truckIDs := make(map[string]string)
+	for _, truck := range names {
+		id := newID()
+		db.Trucks[id] = truck
+		db.TruckNames[KeyName(truck)] = id
+		truckIDs[KeyName(truck)] = id
+	}
+	return truckIDs, nil
+}
+
+// AddTruckNames adds other names for existing trucks.
+func (db *MemoryDB) AddTruckNames(ctx context.Context, names map[string]string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for key, id := range names {
+		db.TruckNames[key] = id
+		delete(db.PendingTrucks, key)
+	}
+	return nil
+}
+
+// AddPendingTrucks records truck names awaiting review.
+func (db *MemoryDB) AddPendingTrucks(ctx context.Context, pending []PendingTruck) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, p := range pending {
+		db.PendingTrucks[KeyName(p.Name)] = p
+	}
+	return nil
+}
+
+// DeleteTrucks deletes trucks and truck names.
+func (db *MemoryDB) DeleteTrucks(ctx context.Context, ids []string, names []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, id := range ids {
+		delete(db.Trucks, id)
+	}
+	for _, name := range names {
+		delete(db.TruckNames, name)
+	}
+	return nil
+}
+
+// StopIDs returns all existing stop IDs in the database.
+func (db *MemoryDB) StopIDs(ctx context.Context) (map[string]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	stopIDs := make(map[string]string)
+	for key, id := range db.StopNames {
+		stopIDs[key] = id
+	}
+	return stopIDs, nil
+}
+
+// AddStops adds new stops to the database and returns their IDs.
+func (db *MemoryDB) AddStops(ctx context.Context, names []string) (map[string]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	stopIDs := make(map[string]string)
+	for _, stop := range names {
+		id := newID()
+		db.Stops[id] = strings.TrimSpace(stop)
+		db.StopNames[StopKeyName(stop)] = id
+		stopIDs[StopKeyName(stop)] = id
+	}
+	return stopIDs, nil
+}
+
+// DeleteStops deletes stops and stop names.
+func (db *MemoryDB) DeleteStops(ctx context.Context, ids []string, names []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, id := range ids {
+		delete(db.Stops, id)
+	}
+	for _, name := range names {
+		delete(db.StopNames, name)
+	}
+	return nil
+}
+
+// GetSchedules returns the stored schedules for the given dates.
+func (db *MemoryDB) GetSchedules(ctx context.Context, dates []string) (map[string]DailySchedule, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	days := make(map[string]DailySchedule)
+	for _, date := range dates {
+		stops, ok := db.Schedules[date]
+		if !ok {
+			continue
+		}
+		day := DailySchedule{}
+		for stop, assignments := range stops {
+			day[stop] = append([]Assignment(nil), assignments...)
+		}
+		days[date] = day
+	}
+	return days, nil
+}
+
+// SetSchedules replaces the schedules for the given dates.
+func (db *MemoryDB) SetSchedules(ctx context.Context, days map[string]DailySchedule) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for date, stops := range days {
+		day := DailySchedule{}
+		for stop, assignments := range stops {
+			day[stop] = append([]Assignment(nil), assignments...)
+		}
+		db.Schedules[date] = day
+	}
+	return nil
+}
+
+// DeleteSchedules deletes the schedules for the given dates.
+func (db *MemoryDB) DeleteSchedules(ctx context.Context, dates []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, date := range dates {
+		delete(db.Schedules, date)
+	}
+	return nil
+}
+
+// AddChangeLog records the changes made to the schedules by a load.
+func (db *MemoryDB) AddChangeLog(ctx context.Context, log ChangeLog) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.ChangeLogs = append(db.ChangeLogs, log)
+	return nil
+}
+
+// GetManifest returns the manifest of the last load of a file.
+func (db *MemoryDB) GetManifest(ctx context.Context, file string) (LoadManifest, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	m, ok := db.Manifests[file]
+	return m, ok, nil
+}
+
+// SetManifest saves the manifest of a load.
+func (db *MemoryDB) SetManifest(ctx context.Context, m LoadManifest) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.Manifests[m.File] = m
+	return nil
+}
+
+// GetFileStatus returns the processing status of a file.
+func (db *MemoryDB) GetFileStatus(ctx context.Context, file string) (FileStatus, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	status, ok := db.Files[file]
+	return status, ok, nil
+}
+
+// SetFileStatus records the processing status of a file. The provenance
+// of the last successful load is kept if the status has none.
+func (db *MemoryDB) SetFileStatus(ctx context.Context, file string, status FileStatus) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if status.Provenance == nil {
+		status.Provenance = db.Files[file].Provenance
+	}
+	db.Files[file] = status
+	return nil
+}
@@ -0,0 +1,87 @@
+package loaddb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isHeaderRow returns whether a record repeats the header, as happens when
+// a table continues on another page: its truck name and at least one other
+// cell are the names of their columns.
+func isHeaderRow(rec map[string]string, columns ColumnMapping) bool {
+	isName := func(field string) bool {
+		key := KeyName(rec[field])
+		return key != "" && (key == KeyName(field) || key == KeyName(columns.Fields[field]))
+	}
+	if !isName(FieldTruck) {
+		return false
+	}
+	for field := range columns.Fields {
+		if field != FieldTruck && isName(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeRows repairs records mapped by `columns` which were split by the
+// extraction of tables from the PDF. Repeated header rows are dropped. Rows
+// with no truck name continue the record before them, e.g. a row split
+// across a page break or a cell wrapped onto another line, so their cells
+// are appended to that record's. The row of each record returned, counted
+// as by ReadCSV, is returned with it, and each repair is returned as a
+// Problem.
+func NormalizeRows(data Records, columns ColumnMapping) (Records, []int, []Problem) {
+	var fields []string
+	for _, field := range allFields() {
+		if _, ok := columns.Fields[field]; ok && field != FieldTruck {
+			fields = append(fields, field)
+		}
+	}
+
+	var records Records
+	var rows []int
+	var repairs []Problem
+	// prevRow is the row of the last record kept.
+	prevRow := 0
+	for i, rec := range data {
+		// The header is row 1.
+		row := i + 2
+		if isHeaderRow(rec, columns) {
+			repairs = append(repairs, Problem{Row: row, Message: "Dropped repeated header row"})
+			continue
+		}
+		if strings.TrimSpace(rec[FieldTruck]) != "" {
+			records = append(records, rec)
+			rows = append(rows, row)
+			prevRow = row
+			continue
+		}
+		var merged []string
+		for _, field := range fields {
+			if strings.TrimSpace(rec[field]) != "" {
+				merged = append(merged, field)
+			}
+		}
+		if len(merged) == 0 {
+			continue
+		}
+		if len(records) == 0 {
+			repairs = append(repairs, Problem{Row: row, Message: "Dropped row with no truck name and no row before it"})
+			continue
+		}
+		prev := make(map[string]string)
+		for k, v := range records[len(records)-1] {
+			prev[k] = v
+		}
+		for _, field := range merged {
+			prev[field] = strings.TrimSpace(strings.TrimSpace(prev[field]) + " " + strings.TrimSpace(rec[field]))
+		}
+		records[len(records)-1] = prev
+		repairs = append(repairs, Problem{
+			Row:     row,
+			Message: fmt.Sprintf("Merged %s into row %d (%s)", strings.Join(merged, ", "), prevRow, prev[FieldTruck]),
+		})
+	}
+	return records, rows, repairs
+}
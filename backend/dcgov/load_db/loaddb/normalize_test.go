@@ -0,0 +1,52 @@
+package loaddb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNormalizeRows(t *testing.T) {
+	data := Records{
+		{"Vendor": "Foo Truck", "Mon": "Farragut", "Tue": "OFF", "Wed": "Stop B", "Thu": "OFF", "Fri": "OFF"},
+		{"Vendor": "", "Mon": "Square", "Tue": "", "Wed": "", "Thu": "", "Fri": ""},
+		{"Vendor": "Vendor", "Mon": "Mon", "Tue": "Tue", "Wed": "Wed", "Thu": "Thu", "Fri": "Fri"},
+		{"Vendor": "Bar Truck", "Mon": "OFF", "Tue": "Stop A", "Wed": "OFF", "Thu": "", "Fri": ""},
+		{"Vendor": "", "Mon": "", "Tue": "", "Wed": "", "Thu": "Stop B", "Fri": "Stop C"},
+		{"Vendor": "", "Mon": "", "Tue": "", "Wed": "", "Thu": "", "Fri": ""},
+	}
+	columns, err := MapColumns(data, nil)
+	if err != nil {
+		t.Fatalf("MapColumns returned error: %v", err)
+	}
+	records, rows, repairs := NormalizeRows(columns.Apply(data), columns)
+	if len(records) != 2 {
+		t.Fatalf("NormalizeRows returned %d records, want 2: %v", len(records), records)
+	}
+	if fmt.Sprint(rows) != "[2 5]" {
+		t.Fatalf("NormalizeRows returned rows %v, want [2 5]", rows)
+	}
+	if records[0]["Monday"] != "Farragut Square" || records[0]["Wednesday"] != "Stop B" {
+		t.Fatalf("NormalizeRows did not merge a wrapped cell: %v", records[0])
+	}
+	if records[1]["Tuesday"] != "Stop A" || records[1]["Thursday"] != "Stop B" || records[1]["Friday"] != "Stop C" {
+		t.Fatalf("NormalizeRows did not merge a row split across pages: %v", records[1])
+	}
+	want := []Problem{
+		{Row: 3, Message: "Merged Monday into row 2 (Foo Truck)"},
+		{Row: 4, Message: "Dropped repeated header row"},
+		{Row: 6, Message: "Merged Thursday, Friday into row 5 (Bar Truck)"},
+	}
+	if fmt.Sprint(repairs) != fmt.Sprint(want) {
+		t.Fatalf("NormalizeRows returned repairs %v, want %v", repairs, want)
+	}
+	if data[0]["Mon"] != "Farragut" {
+		t.Fatal("NormalizeRows changed its input")
+	}
+
+	orphan := Records{{"Business Name": "", "Monday": "A", "Tuesday": "", "Wednesday": "", "Thursday": "", "Friday": ""}}
+	columns, _ = MapColumns(orphan, nil)
+	records, _, repairs = NormalizeRows(orphan, columns)
+	if len(records) != 0 || len(repairs) != 1 {
+		t.Fatalf("NormalizeRows returned %v, %v for a continuation row with no row before it", records, repairs)
+	}
+}
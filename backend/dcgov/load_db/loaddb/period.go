@@ -0,0 +1,204 @@
+package loaddb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A YearMonth identifies a calendar month.
+type YearMonth struct {
+	Year  int
+	Month time.Month
+}
+
+// Start returns midnight UTC on the first day of the month.
+func (ym YearMonth) Start() time.Time {
+	return time.Date(ym.Year, ym.Month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// End returns midnight UTC on the last day of the month.
+func (ym YearMonth) End() time.Time {
+	return ym.Start().AddDate(0, 1, -1)
+}
+
+// AddMonths returns the month n months after ym.
+func (ym YearMonth) AddMonths(n int) YearMonth {
+	t := ym.Start().AddDate(0, n, 0)
+	return YearMonth{Year: t.Year(), Month: t.Month()}
+}
+
+// Before returns whether ym is before other.
+func (ym YearMonth) Before(other YearMonth) bool {
+	return ym.Year < other.Year || ym.Year == other.Year && ym.Month < other.Month
+}
+
+func (ym YearMonth) String() string {
+	return ym.Start().Format("2006-01")
+}
+
+// monthRange returns all months from first to last, inclusive.
+func monthRange(first, last YearMonth) []YearMonth {
+	var result []YearMonth
+	for ym := first; !last.Before(ym); ym = ym.AddMonths(1) {
+		result = append(result, ym)
+	}
+	return result
+}
+
+// monthName matches a month's name or abbreviation.
+const monthName = `jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sept?(?:ember)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?`
+
+var (
+	// fiscalRe matches a DC government fiscal year and optional quarter,
+	// e.g. "FY20", "FY2020 Q1" or "Q1 FY20".
+	fiscalRe        = regexp.MustCompile(`(?i)(?:^|[^a-z])fy\s*'?(\d{4}|\d{2})(?:[\s_-]*q([1-4]))?(?:[^0-9]|$)`)
+	quarterFiscalRe = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])q([1-4])[\s_-]*fy\s*'?(\d{4}|\d{2})(?:[^0-9]|$)`)
+	// rangeRe matches a range of months, e.g. "July-September 2019",
+	// "Nov 2019 through Jan 2020" or "Feb-Mar-Apr 2019".
+	rangeRe = regexp.MustCompile(`(?i)(?:^|[^a-z])(` + monthName + `)\.?(?:[\s,_]*(\d{4}))?(?:\s*[-–—,]\s*(?:` + monthName + `)\.?)*\s*(?:-|–|—|to|through|thru)\s*(` + monthName + `)\.?[\s,_-]*(\d{4})(?:[^0-9]|$)`)
+	// monthYearRe matches a month's name followed by an optional day and a
+	// year, e.g. "Jul 2019" or "October 1, 2019".
+	monthYearRe = regexp.MustCompile(`(?i)(?:^|[^a-z])(` + monthName + `)\.?[\s,_-]*(?:\d{1,2}(?:st|nd|rd|th)?[\s,_-]+)?(\d{4})(?:[^0-9]|$)`)
+	// yearMonthRe matches a year followed by a month's name, e.g. "2019 July".
+	yearMonthRe = regexp.MustCompile(`(?i)(?:^|[^0-9])(\d{4})[\s,_-]*(` + monthName + `)(?:[^a-z]|$)`)
+	// dateRe matches a numeric US date, e.g. "10-1-2019" or "10.01.2019".
+	dateRe = regexp.MustCompile(`(?:^|[^0-9])(\d{1,2})[-_./](\d{1,2})[-_./](\d{4})(?:[^0-9]|$)`)
+	// isoRe matches a numeric year and month, e.g. "2019-07".
+	isoRe = regexp.MustCompile(`(?:^|[^0-9])(\d{4})[-_./](\d{1,2})(?:[^0-9]|$)`)
+	// numericRe matches a numeric month and year, e.g. "07_2019".
+	numericRe = regexp.MustCompile(`(?:^|[^0-9])(\d{1,2})[-_./](\d{4})(?:[^0-9]|$)`)
+)
+
+// parseMonth returns the month for a month's name or abbreviation.
+func parseMonth(s string) (time.Month, bool) {
+	m, ok := months[strings.ToLower(s[0:3])]
+	return time.Month(m), ok
+}
+
+// parseYear returns the year for a four digit year, or a two digit year
+// which is taken to be in the 2000s, if it is plausible for a lottery file.
+func parseYear(s string) (int, bool) {
+	y, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	if len(s) == 2 {
+		y += 2000
+	}
+	return y, y >= 2000 && y < 2100
+}
+
+// parseNumericMonth returns the month for a number from 1 to 12.
+func parseNumericMonth(s string) (time.Month, bool) {
+	m, err := strconv.Atoi(s)
+	return time.Month(m), err == nil && m >= 1 && m <= 12
+}
+
+// fiscalMonths returns the months in a DC government fiscal year, which
+// starts on October 1 of the previous calendar year, or in one quarter of
+// it if quarter is not zero.
+func fiscalMonths(year int, quarter int) []YearMonth {
+	first := YearMonth{Year: year - 1, Month: time.October}
+	if quarter == 0 {
+		return monthRange(first, first.AddMonths(11))
+	}
+	first = first.AddMonths(3 * (quarter - 1))
+	return monthRange(first, first.AddMonths(2))
+}
+
+// ParsePeriod returns the months covered by a lottery file, in order, based
+// on text such as its name. It recognizes, in order of preference:
+//
+//	ranges of months:           "July-September 2019", "Nov 2019 to Jan 2020"
+//	month names with a year:    "Results for July 2019", "Jul2019", "2019 July"
+//	month names with a date:    "October 1, 2019", "Oct 1 2019"
+//	numeric dates:              "10-1-2019", "10.01.2019" (month first)
+//	numeric months with a year: "2019-07 results", "07_2019"
+//	fiscal years and quarters:  "FY20", "FY2020 Q1", "Q1 FY20"
+//
+// Month names may be abbreviated and may appear anywhere in the string. A
+// fiscal year is only used if no month is given, so "July 2019 - FY19" is
+// July 2019.
+func ParsePeriod(s string) ([]YearMonth, error) {
+	period, _, err := parsePeriod(s)
+	return period, err
+}
+
+// parsePeriod is ParsePeriod, also returning whether the period was only a
+// fiscal year or quarter.
+func parsePeriod(s string) ([]YearMonth, bool, error) {
+	if m := rangeRe.FindStringSubmatch(s); m != nil {
+		startMonth, ok1 := parseMonth(m[1])
+		endMonth, ok2 := parseMonth(m[3])
+		endYear, ok3 := parseYear(m[4])
+		if ok1 && ok2 && ok3 {
+			startYear := endYear
+			if m[2] != "" {
+				startYear, _ = parseYear(m[2])
+			} else if startMonth > endMonth {
+				startYear = endYear - 1
+			}
+			first := YearMonth{Year: startYear, Month: startMonth}
+			last := YearMonth{Year: endYear, Month: endMonth}
+			if !last.Before(first) {
+				return monthRange(first, last), false, nil
+			}
+		}
+	}
+	if m := monthYearRe.FindStringSubmatch(s); m != nil {
+		month, ok1 := parseMonth(m[1])
+		year, ok2 := parseYear(m[2])
+		if ok1 && ok2 {
+			return []YearMonth{{Year: year, Month: month}}, false, nil
+		}
+	}
+	if m := yearMonthRe.FindStringSubmatch(s); m != nil {
+		year, ok1 := parseYear(m[1])
+		month, ok2 := parseMonth(m[2])
+		if ok1 && ok2 {
+			return []YearMonth{{Year: year, Month: month}}, false, nil
+		}
+	}
+	if m := dateRe.FindStringSubmatch(s); m != nil {
+		// The day and year would otherwise look like a numeric month and
+		// year, so a date which is not month-day-year is not guessed at.
+		month, ok1 := parseNumericMonth(m[1])
+		day, err := strconv.Atoi(m[2])
+		year, ok2 := parseYear(m[3])
+		if !ok1 || err != nil || day < 1 || day > 31 || !ok2 {
+			return nil, false, fmt.Errorf("Date %q is not month-day-year", strings.Trim(m[0], "-_./ "))
+		}
+		return []YearMonth{{Year: year, Month: month}}, false, nil
+	}
+	if m := isoRe.FindStringSubmatch(s); m != nil {
+		year, ok1 := parseYear(m[1])
+		month, ok2 := parseNumericMonth(m[2])
+		if ok1 && ok2 {
+			return []YearMonth{{Year: year, Month: month}}, false, nil
+		}
+	}
+	if m := numericRe.FindStringSubmatch(s); m != nil {
+		month, ok1 := parseNumericMonth(m[1])
+		year, ok2 := parseYear(m[2])
+		if ok1 && ok2 {
+			return []YearMonth{{Year: year, Month: month}}, false, nil
+		}
+	}
+	if m := quarterFiscalRe.FindStringSubmatch(s); m != nil {
+		if year, ok := parseYear(m[2]); ok {
+			quarter, _ := strconv.Atoi(m[1])
+			return fiscalMonths(year, quarter), true, nil
+		}
+	}
+	if m := fiscalRe.FindStringSubmatch(s); m != nil {
+		if year, ok := parseYear(m[1]); ok {
+			quarter, _ := strconv.Atoi(m[2])
+			return fiscalMonths(year, quarter), true, nil
+		}
+	}
+	return nil, false, errors.New("No month and year found")
+}
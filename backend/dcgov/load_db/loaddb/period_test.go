@@ -0,0 +1,73 @@
+package loaddb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		s     string
+		first YearMonth
+		n     int
+	}{
+		{"Jul 2019 foo bar", YearMonth{2019, time.July}, 1},
+		{"December2019foobar", YearMonth{2019, time.December}, 1},
+		{"Apr 2017 - MRV Lottery Results", YearMonth{2017, time.April}, 1},
+		{"Results for July 2019", YearMonth{2019, time.July}, 1},
+		{"MRV_Lottery_Sept_2019", YearMonth{2019, time.September}, 1},
+		{"2019 July results", YearMonth{2019, time.July}, 1},
+		{"2019-07 results", YearMonth{2019, time.July}, 1},
+		{"07_2019", YearMonth{2019, time.July}, 1},
+		{"Lottery 7.2019", YearMonth{2019, time.July}, 1},
+		{"July-September 2019", YearMonth{2019, time.July}, 3},
+		{"Jul - Sep 2019", YearMonth{2019, time.July}, 3},
+		{"November through January 2020", YearMonth{2019, time.November}, 3},
+		{"Nov 2019 to Feb 2020", YearMonth{2019, time.November}, 4},
+		{"FY20 Q1", YearMonth{2019, time.October}, 3},
+		{"FY2020_Q3 Lottery", YearMonth{2020, time.April}, 3},
+		{"Q4 FY19", YearMonth{2019, time.July}, 3},
+		{"FY21 Lottery Results", YearMonth{2020, time.October}, 12},
+		{"July 2019 - FY19 MRV Lottery Results", YearMonth{2019, time.July}, 1},
+		{"FY20 Q1 - Nov 2019", YearMonth{2019, time.November}, 1},
+		{"MRV Lottery 10-1-2019", YearMonth{2019, time.October}, 1},
+		{"Lottery Results 10.01.2019", YearMonth{2019, time.October}, 1},
+		{"MRV_Lottery_10_1_2019", YearMonth{2019, time.October}, 1},
+		{"Oct 1 2019", YearMonth{2019, time.October}, 1},
+		{"Lottery October 1, 2019", YearMonth{2019, time.October}, 1},
+		{"Sept 3rd 2019", YearMonth{2019, time.September}, 1},
+		{"Feb-Mar-Apr 2019", YearMonth{2019, time.February}, 3},
+		{"Nov, Dec - Jan 2020", YearMonth{2019, time.November}, 3},
+	}
+	for _, test := range tests {
+		period, err := ParsePeriod(test.s)
+		if err != nil {
+			t.Errorf("ParsePeriod(%q) returned error: %v", test.s, err)
+			continue
+		}
+		if period[0] != test.first || len(period) != test.n {
+			t.Errorf("ParsePeriod(%q) = %v, want %d months from %v", test.s, period, test.n, test.first)
+			continue
+		}
+		for i := 1; i < len(period); i++ {
+			if period[i] != period[i-1].AddMonths(1) {
+				t.Errorf("ParsePeriod(%q) returned months out of order: %v", test.s, period)
+			}
+		}
+	}
+
+	invalid := []string{
+		"FooBar",
+		"MRV-Lottery-Results-Final",
+		"Summary 2019",
+		"13_2019",
+		"Mayor's Lottery",
+		"Lottery 13.01.2019",
+		"Lottery 10-32-2019",
+	}
+	for _, s := range invalid {
+		if period, err := ParsePeriod(s); err == nil {
+			t.Errorf("ParsePeriod(%q) = %v, want error", s, period)
+		}
+	}
+}
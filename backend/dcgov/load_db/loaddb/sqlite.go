@@ -0,0 +1,546 @@
+package loaddb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqliteSchema creates the tables used by SQLiteDB. They mirror the trucks,
+// truckNames, pendingTruckNames, stops, stopNames, schedules,
+// scheduleChanges, loadManifests and dcGovFiles Firestore collections.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS trucks (
+		id TEXT PRIMARY KEY,
+		display_name TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS truck_names (
+		name TEXT PRIMARY KEY,
+		id TEXT NOT NULL REFERENCES trucks (id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS pending_truck_names (
+		name TEXT PRIMARY KEY,
+		display_name TEXT NOT NULL,
+		candidate_id TEXT NOT NULL,
+		candidate_name TEXT NOT NULL,
+		score REAL NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS stops (
+		id TEXT PRIMARY KEY,
+		display_name TEXT NOT NULL,
+		latitude REAL,
+		longitude REAL
+	)`,
+	`CREATE TABLE IF NOT EXISTS stop_names (
+		name TEXT PRIMARY KEY,
+		id TEXT NOT NULL REFERENCES stops (id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS schedules (
+		date TEXT NOT NULL,
+		stop_id TEXT NOT NULL,
+		truck_id TEXT NOT NULL,
+		start_time TEXT NOT NULL DEFAULT '',
+		end_time TEXT NOT NULL DEFAULT '',
+		notes TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (date, stop_id, truck_id, start_time)
+	)`,
+	`CREATE TABLE IF NOT EXISTS schedule_changes (
+		file TEXT NOT NULL,
+		time TEXT NOT NULL,
+		date TEXT NOT NULL,
+		stop_id TEXT NOT NULL,
+		truck_id TEXT NOT NULL,
+		start_time TEXT NOT NULL DEFAULT '',
+		end_time TEXT NOT NULL DEFAULT '',
+		added INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS load_manifests (
+		file TEXT PRIMARY KEY,
+		manifest TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS dc_gov_files (
+		name TEXT PRIMARY KEY,
+		ok INTEGER NOT NULL,
+		state TEXT NOT NULL DEFAULT '',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		stage TEXT NOT NULL DEFAULT '',
+		last_error TEXT NOT NULL DEFAULT '',
+		first_attempt TEXT NOT NULL DEFAULT '',
+		last_attempt TEXT NOT NULL DEFAULT '',
+		next_attempt TEXT NOT NULL DEFAULT '',
+		provenance TEXT NOT NULL DEFAULT ''
+	)`,
+}
+
+// sqliteMigrations are the changes made to the schema of a SQLiteDB, in
+// order. A database's user_version is the number of them applied to it, so
+// a database created by an older version of the loader is upgraded by the
+// ones after it. CREATE TABLE IF NOT EXISTS does not change existing tables,
+// so to change the schema, add a migration, e.g. ALTER TABLE, rather than
+// editing sqliteSchema or an earlier migration.
+var sqliteMigrations = [][]string{
+	sqliteSchema,
+	sqliteWindowKey,
+}
+
+// sqliteWindowKey adds end_time to the key of the schedules table, so that
+// a truck's windows at a stop which start at the same time but end at
+// different times are both kept, as they are in Firestore. SQLite cannot
+// change a table's key, so the table is copied.
+var sqliteWindowKey = []string{
+	`CREATE TABLE schedules_new (
+		date TEXT NOT NULL,
+		stop_id TEXT NOT NULL,
+		truck_id TEXT NOT NULL,
+		start_time TEXT NOT NULL DEFAULT '',
+		end_time TEXT NOT NULL DEFAULT '',
+		notes TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (date, stop_id, truck_id, start_time, end_time)
+	)`,
+	`INSERT INTO schedules_new (date, stop_id, truck_id, start_time, end_time, notes)
+	SELECT date, stop_id, truck_id, start_time, end_time, notes FROM schedules`,
+	`DROP TABLE schedules`,
+	`ALTER TABLE schedules_new RENAME TO schedules`,
+}
+
+// SQLiteDB is a DB backed by a SQLite database, for running without
+// Firebase. It uses database/sql, so the program must register a SQLite
+// driver, e.g. by importing github.com/mattn/go-sqlite3.
+type SQLiteDB struct {
+	db *sql.DB
+}
+
+// NewSQLiteDB returns a DB using the given SQLite database, creating its
+// tables or upgrading them if they are out of date. An in-memory database
+// must be limited to one connection, since each connection to ":memory:"
+// opens a new, empty database.
+func NewSQLiteDB(ctx context.Context, db *sql.DB) (*SQLiteDB, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return nil, err
+	}
+	if version > len(sqliteMigrations) {
+		return nil, fmt.Errorf("SQLite database is version %d, newer than the latest known version %d",
+			version, len(sqliteMigrations))
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for _, migration := range sqliteMigrations[version:] {
+		for _, stmt := range migration {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// PRAGMA does not accept parameters.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, len(sqliteMigrations))); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &SQLiteDB{db: db}, nil
+}
+
+// TruckIDs returns all existing truck IDs in the database.
+func (db *SQLiteDB) TruckIDs(ctx context.Context) (map[string]string, error) {
+	rows, err := db.db.QueryContext(ctx, `SELECT name, id FROM truck_names`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	truckIDs := make(map[string]string)
+	for rows.Next() {
+		var name, id string
+		if err := rows.Scan(&name, &id); err != nil {
+			return nil, err
+		}
+		truckIDs[name] = id
+	}
+	return truckIDs, rows.Err()
+}
+
+// TruckDisplayNames returns the display name of each truck in the database.
+func (db *SQLiteDB) TruckDisplayNames(ctx context.Context) (map[string]string, error) {
+	rows, err := db.db.QueryContext(ctx, `SELECT id, display_name FROM trucks`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	trucks := make(map[string]string)
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		trucks[id] = name
+	}
+	return trucks, rows.Err()
+}
+
+// AddTrucks adds new trucks to the database and returns their IDs.
+func (db *SQLiteDB) AddTrucks(ctx context.Context, names []string) (map[string]string, error) {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	truckIDs := make(map[string]string)
+	for _, truck := range names {
+		id := newID()
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO trucks (id, display_name) VALUES (?, ?)`, id, truck)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO truck_names (name, id) VALUES (?, ?)`, KeyName(truck), id)
+		if err != nil {
+			return nil, err
+		}
+		truckIDs[KeyName(truck)] = id
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return truckIDs, nil
+}
+
+// AddTruckNames adds other names for existing trucks.
+func (db *SQLiteDB) AddTruckNames(ctx context.Context, names map[string]string) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for key, id := range names {
+		_, err = tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO truck_names (name, id) VALUES (?, ?)`, key, id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM pending_truck_names WHERE name = ?`, key)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AddPendingTrucks records truck names awaiting review.
+func (db *SQLiteDB) AddPendingTrucks(ctx context.Context, pending []PendingTruck) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, p := range pending {
+		_, err = tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO pending_truck_names
+			(name, display_name, candidate_id, candidate_name, score) VALUES (?, ?, ?, ?, ?)`,
+			KeyName(p.Name), p.Name, p.CandidateID, p.CandidateName, p.Score)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// deleteWhere deletes the rows of `table` whose `column` is one of `values`.
+func (db *SQLiteDB) deleteWhere(ctx context.Context, tx *sql.Tx, table string, column string, values []string) error {
+	for _, v := range values {
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+column+` = ?`, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteTrucks deletes trucks and truck names.
+func (db *SQLiteDB) DeleteTrucks(ctx context.Context, ids []string, names []string) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := db.deleteWhere(ctx, tx, "truck_names", "name", names); err != nil {
+		return err
+	}
+	if err := db.deleteWhere(ctx, tx, "trucks", "id", ids); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// StopIDs returns all existing stop IDs in the database.
+func (db *SQLiteDB) StopIDs(ctx context.Context) (map[string]string, error) {
+	rows, err := db.db.QueryContext(ctx, `SELECT name, id FROM stop_names`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stopIDs := make(map[string]string)
+	for rows.Next() {
+		var name, id string
+		if err := rows.Scan(&name, &id); err != nil {
+			return nil, err
+		}
+		stopIDs[name] = id
+	}
+	return stopIDs, rows.Err()
+}
+
+// AddStops adds new stops to the database and returns their IDs.
+func (db *SQLiteDB) AddStops(ctx context.Context, names []string) (map[string]string, error) {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stopIDs := make(map[string]string)
+	for _, stop := range names {
+		id := newID()
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO stops (id, display_name) VALUES (?, ?)`, id, strings.TrimSpace(stop))
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO stop_names (name, id) VALUES (?, ?)`, StopKeyName(stop), id)
+		if err != nil {
+			return nil, err
+		}
+		stopIDs[StopKeyName(stop)] = id
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return stopIDs, nil
+}
+
+// DeleteStops deletes stops and stop names.
+func (db *SQLiteDB) DeleteStops(ctx context.Context, ids []string, names []string) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := db.deleteWhere(ctx, tx, "stop_names", "name", names); err != nil {
+		return err
+	}
+	if err := db.deleteWhere(ctx, tx, "stops", "id", ids); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetSchedules returns the stored schedules for the given dates.
+func (db *SQLiteDB) GetSchedules(ctx context.Context, dates []string) (map[string]DailySchedule, error) {
+	days := make(map[string]DailySchedule)
+	for _, date := range dates {
+		rows, err := db.db.QueryContext(ctx,
+			`SELECT stop_id, truck_id, start_time, end_time, notes FROM schedules WHERE date = ?`, date)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var stop string
+			var a Assignment
+			if err := rows.Scan(&stop, &a.Truck, &a.Start, &a.End, &a.Notes); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if days[date] == nil {
+				days[date] = DailySchedule{}
+			}
+			days[date][stop] = append(days[date][stop], a)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return days, nil
+}
+
+// SetSchedules replaces the schedules for the given dates.
+func (db *SQLiteDB) SetSchedules(ctx context.Context, days map[string]DailySchedule) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for date, stops := range days {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schedules WHERE date = ?`, date)
+		if err != nil {
+			return err
+		}
+		for stop, assignments := range stops {
+			for _, a := range assignments {
+				_, err = tx.ExecContext(ctx,
+					`INSERT OR IGNORE INTO schedules (date, stop_id, truck_id, start_time, end_time, notes)
+					VALUES (?, ?, ?, ?, ?, ?)`,
+					date, stop, a.Truck, a.Start, a.End, a.Notes)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteSchedules deletes the schedules for the given dates.
+func (db *SQLiteDB) DeleteSchedules(ctx context.Context, dates []string) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := db.deleteWhere(ctx, tx, "schedules", "date", dates); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddChangeLog records the changes made to the schedules by a load, one
+// row per assignment added or removed.
+func (db *SQLiteDB) AddChangeLog(ctx context.Context, log ChangeLog) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insert := func(date, stop string, a Assignment, added bool) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO schedule_changes (file, time, date, stop_id, truck_id, start_time, end_time, added)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			log.File, log.Time.Format(time.RFC3339), date, stop, a.Truck, a.Start, a.End, added)
+		return err
+	}
+	for date, diff := range log.Days {
+		for stop, d := range diff {
+			for _, a := range d.Added {
+				if err := insert(date, stop, a, true); err != nil {
+					return err
+				}
+			}
+			for _, a := range d.Removed {
+				if err := insert(date, stop, a, false); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// GetManifest returns the manifest of the last load of a file.
+func (db *SQLiteDB) GetManifest(ctx context.Context, file string) (LoadManifest, bool, error) {
+	var data string
+	err := db.db.QueryRowContext(ctx,
+		`SELECT manifest FROM load_manifests WHERE file = ?`, file).Scan(&data)
+	if err == sql.ErrNoRows {
+		return LoadManifest{}, false, nil
+	}
+	if err != nil {
+		return LoadManifest{}, false, err
+	}
+	var m LoadManifest
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		return LoadManifest{}, false, err
+	}
+	return m, true, nil
+}
+
+// SetManifest saves the manifest of a load, as JSON.
+func (db *SQLiteDB) SetManifest(ctx context.Context, m LoadManifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO load_manifests (file, manifest) VALUES (?, ?)`, m.File, string(data))
+	return err
+}
+
+// sqliteTime formats a time for storage, as an empty string if it is zero.
+func sqliteTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseSQLiteTime parses a time formatted by sqliteTime.
+func parseSQLiteTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// GetFileStatus returns the processing status of a file.
+func (db *SQLiteDB) GetFileStatus(ctx context.Context, file string) (FileStatus, bool, error) {
+	var s FileStatus
+	var first, last, next, provenance string
+	err := db.db.QueryRowContext(ctx,
+		`SELECT ok, state, attempts, stage, last_error, first_attempt, last_attempt, next_attempt, provenance
+		FROM dc_gov_files WHERE name = ?`, file).Scan(
+		&s.OK, &s.State, &s.Attempts, &s.Stage, &s.LastError, &first, &last, &next, &provenance)
+	if err == sql.ErrNoRows {
+		return FileStatus{}, false, nil
+	}
+	if err != nil {
+		return FileStatus{}, false, err
+	}
+	for _, t := range []struct {
+		dst *time.Time
+		src string
+	}{{&s.FirstAttempt, first}, {&s.LastAttempt, last}, {&s.NextAttempt, next}} {
+		if *t.dst, err = parseSQLiteTime(t.src); err != nil {
+			return FileStatus{}, false, err
+		}
+	}
+	if provenance != "" {
+		s.Provenance = &Provenance{}
+		if err := json.Unmarshal([]byte(provenance), s.Provenance); err != nil {
+			return FileStatus{}, false, err
+		}
+	}
+	return s, true, nil
+}
+
+// SetFileStatus records the processing status of a file. The provenance
+// of the last successful load is kept if the status has none.
+func (db *SQLiteDB) SetFileStatus(ctx context.Context, file string, status FileStatus) error {
+	var provenance string
+	if status.Provenance != nil {
+		data, err := json.Marshal(status.Provenance)
+		if err != nil {
+			return err
+		}
+		provenance = string(data)
+	}
+	_, err := db.db.ExecContext(ctx,
+		`INSERT INTO dc_gov_files
+		(name, ok, state, attempts, stage, last_error, first_attempt, last_attempt, next_attempt, provenance)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+		ok = excluded.ok, state = excluded.state, attempts = excluded.attempts, stage = excluded.stage,
+		last_error = excluded.last_error, first_attempt = excluded.first_attempt,
+		last_attempt = excluded.last_attempt, next_attempt = excluded.next_attempt,
+		provenance = COALESCE(NULLIF(excluded.provenance, ''), provenance)`,
+		file, status.OK, status.State, status.Attempts, status.Stage, status.LastError,
+		sqliteTime(status.FirstAttempt), sqliteTime(status.LastAttempt), sqliteTime(status.NextAttempt),
+		provenance)
+	return err
+}
@@ -0,0 +1,253 @@
+package loaddb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTestSQLite returns a new in-memory SQLite database.
+func openTestSQLite(t *testing.T) *sql.DB {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetMaxOpenConns(1)
+	return conn
+}
+
+func newTestSQLiteDB(t *testing.T, conn *sql.DB) *SQLiteDB {
+	db, err := NewSQLiteDB(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("NewSQLiteDB returned error: %v", err)
+	}
+	return db
+}
+
+// dbSnapshot returns the truck names, stop names and schedules in a DB as
+// sorted lines, with IDs replaced by names, so that DBs which gave the same
+// trucks and stops different IDs can be compared.
+func dbSnapshot(t *testing.T, db DB) []string {
+	ctx := context.Background()
+	truckIDs, err := db.TruckIDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	displayNames, err := db.TruckDisplayNames(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopIDs, err := db.StopIDs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stops := make(map[string]string)
+	var lines []string
+	for key, id := range truckIDs {
+		lines = append(lines, fmt.Sprintf("truck %s %s", key, displayNames[id]))
+	}
+	for key, id := range stopIDs {
+		stops[id] = key
+		lines = append(lines, "stop "+key)
+	}
+	var dates []string
+	for date := range secondSchedule.Days {
+		dates = append(dates, date)
+	}
+	days, err := db.GetSchedules(ctx, dates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for date, day := range days {
+		for stop, assignments := range day {
+			for _, a := range assignments {
+				lines = append(lines, fmt.Sprintf("%s %s %s %s-%s %s",
+					date, stops[stop], displayNames[a.Truck], a.Start, a.End, a.Notes))
+			}
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestSQLiteDBUpload(t *testing.T) {
+	conn := openTestSQLite(t)
+	defer conn.Close()
+	db := newTestSQLiteDB(t, conn)
+	mem := NewMemoryDB()
+
+	for _, schedule := range []Schedule{firstSchedule, secondSchedule} {
+		for _, d := range []DB{db, mem} {
+			if err := Upload(schedule, d, "july.csv"); err != nil {
+				t.Fatalf("Upload to %T returned error: %v", d, err)
+			}
+		}
+		got, want := dbSnapshot(t, db), dbSnapshot(t, mem)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("SQLiteDB after Upload:\n%v\nwant (as MemoryDB)\n%v", got, want)
+		}
+	}
+	m, ok, err := db.GetManifest(context.Background(), "july.csv")
+	if err != nil || !ok || m.Stage != LoadDone {
+		t.Fatalf("GetManifest = %v, %v, %v, want a finished load", m, ok, err)
+	}
+}
+
+func TestSQLiteDBRollback(t *testing.T) {
+	ctx := context.Background()
+	steps := []string{"AddTrucks", "AddStops", "SetSchedules", "AddChangeLog"}
+	for _, step := range steps {
+		conn := openTestSQLite(t)
+		db := newTestSQLiteDB(t, conn)
+		if err := Upload(firstSchedule, db, "july.csv"); err != nil {
+			t.Fatalf("Upload returned error: %v", err)
+		}
+		before := dbSnapshot(t, db)
+
+		faulty := newFaultyDB(db, map[string]int{step: 1})
+		if err := Upload(secondSchedule, faulty, "july.csv"); err == nil {
+			t.Fatalf("Upload did not return an error when %s failed", step)
+		}
+		if after := dbSnapshot(t, db); !reflect.DeepEqual(before, after) {
+			t.Fatalf("Upload did not roll back when %s failed:\nbefore %v\nafter  %v", step, before, after)
+		}
+		if m, _, err := db.GetManifest(ctx, "july.csv"); err != nil || m.Stage != LoadRolledBack {
+			t.Fatalf("Upload left the manifest in stage %q (%v) when %s failed", m.Stage, err, step)
+		}
+
+		// The rollback can also be run on its own after a load which was
+		// interrupted part way.
+		faulty = newFaultyDB(db, map[string]int{"AddChangeLog": 1, "SetSchedules": 2})
+		if err := Upload(secondSchedule, faulty, "july.csv"); err == nil {
+			t.Fatal("Upload did not return an error")
+		}
+		if err := RollbackLoad("july.csv", db); err != nil {
+			t.Fatalf("RollbackLoad returned error: %v", err)
+		}
+		if after := dbSnapshot(t, db); !reflect.DeepEqual(before, after) {
+			t.Fatalf("RollbackLoad did not roll back:\nbefore %v\nafter  %v", before, after)
+		}
+		conn.Close()
+	}
+}
+
+func TestSQLiteDBWindows(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestSQLite(t)
+	defer conn.Close()
+	db := newTestSQLiteDB(t, conn)
+
+	// Windows which start at the same time are different windows, unless
+	// they also end at the same time.
+	day := DailySchedule{"stop": {
+		{Truck: "foo", Start: "11:00", End: "14:00"},
+		{Truck: "foo", Start: "11:00", End: "15:00", Notes: "Fridays only"},
+		{Truck: "foo", Start: "11:00", End: "14:00"},
+	}}
+	if err := db.SetSchedules(ctx, map[string]DailySchedule{"2019-07-01": day}); err != nil {
+		t.Fatalf("SetSchedules returned error: %v", err)
+	}
+	days, err := db.GetSchedules(ctx, []string{"2019-07-01"})
+	if err != nil {
+		t.Fatalf("GetSchedules returned error: %v", err)
+	}
+	got := days["2019-07-01"]["stop"]
+	sort.Slice(got, func(i, j int) bool { return got[i].End < got[j].End })
+	if want := day["stop"][:2]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetSchedules returned %v, want %v", got, want)
+	}
+}
+
+func TestSQLiteDBFileStatus(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestSQLite(t)
+	defer conn.Close()
+	db := newTestSQLiteDB(t, conn)
+
+	if _, found, err := db.GetFileStatus(ctx, "july"); err != nil || found {
+		t.Fatalf("GetFileStatus of a new file = %v, %v, want not found", found, err)
+	}
+	now := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	p := &Provenance{
+		SourceURL: "https://dcra.dc.gov/july.pdf",
+		Trucks:    2,
+		Columns:   map[string]string{FieldTruck: "Vendor"},
+		StartDate: "2019-07-01",
+		Loaded:    now,
+	}
+	want := FileStatus{}.Failed(StageLoad, fmt.Errorf("No rows"), now)
+	want.Provenance = p
+	if err := db.SetFileStatus(ctx, "july", want); err != nil {
+		t.Fatalf("SetFileStatus returned error: %v", err)
+	}
+	got, found, err := db.GetFileStatus(ctx, "july")
+	if err != nil || !found {
+		t.Fatalf("GetFileStatus = %v, %v", found, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetFileStatus = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewSQLiteDBVersion(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestSQLite(t)
+	defer conn.Close()
+
+	// Opening a database a second time leaves it as it is.
+	db := newTestSQLiteDB(t, conn)
+	if err := db.SetFileStatus(ctx, "july", FileStatus{}.Succeeded(nil, time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	db = newTestSQLiteDB(t, conn)
+	if _, found, err := db.GetFileStatus(ctx, "july"); err != nil || !found {
+		t.Fatalf("GetFileStatus after reopening = %v, %v", found, err)
+	}
+	var version int
+	if err := conn.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(sqliteMigrations) {
+		t.Fatalf("NewSQLiteDB set version %d, want %d", version, len(sqliteMigrations))
+	}
+
+	if _, err := conn.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, len(sqliteMigrations)+1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSQLiteDB(ctx, conn); err == nil {
+		t.Fatal("NewSQLiteDB did not return an error for a newer database")
+	}
+}
+
+func TestNewSQLiteDBUpgrade(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestSQLite(t)
+	defer conn.Close()
+
+	// A database created before windows were keyed by their end time.
+	for _, stmt := range append(sqliteSchema, `PRAGMA user_version = 1`) {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := conn.Exec(`INSERT INTO schedules (date, stop_id, truck_id, start_time, end_time)
+		VALUES ('2019-07-01', 'stop', 'foo', '11:00', '14:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newTestSQLiteDB(t, conn)
+	days, err := db.GetSchedules(ctx, []string{"2019-07-01"})
+	if err != nil {
+		t.Fatalf("GetSchedules returned error: %v", err)
+	}
+	want := []Assignment{{Truck: "foo", Start: "11:00", End: "14:00"}}
+	if got := days["2019-07-01"]["stop"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetSchedules after upgrading returned %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+package loaddb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// LoaderVersion is recorded with each file loaded. Increase it when a change
+// alters what is loaded from a file.
+const LoaderVersion = "4"
+
+// The states of a file in the dcGovFiles collection.
+const (
+	// FileProcessing means the file was fetched and is being converted and
+	// loaded.
+	FileProcessing = "processing"
+	// FileOK means the file was loaded.
+	FileOK = "ok"
+	// FileRetry means the file failed and will be fetched again after
+	// NextAttempt.
+	FileRetry = "retry"
+	// FileDead means the file failed MaxAttempts times and will not be
+	// retried until a maintainer requeues it.
+	FileDead = "dead"
+)
+
+// The stages at which processing a file can fail.
+const (
+	StageFetch   = "fetch"
+	StageConvert = "convert"
+	StageLoad    = "load"
+)
+
+// The retry policy for failed files. It must match the one in get_pdfs and convert_pdf,
+// which TestRetryPolicyMatches in load_db checks.
+const (
+	// MaxAttempts is the number of times a file may fail before it is
+	// dead-lettered.
+	MaxAttempts = 5
+	// RetryBase is the time to wait before retrying a file after its first
+	// failure. It doubles with each failure, up to RetryMax.
+	RetryBase = time.Hour
+	// RetryMax is the longest time to wait before retrying a file.
+	RetryMax = 24 * time.Hour
+)
+
+// FileStatus is the processing status of a file, kept in the dcGovFiles
+// collection. The same document is updated by the fetch, convert and load
+// stages.
+type FileStatus struct {
+	OK    bool   `firestore:"ok"`
+	State string `firestore:"state"`
+	// Attempts is the number of failed attempts since the file was last
+	// requeued.
+	Attempts int `firestore:"attempts"`
+	// Stage and LastError describe the last failure.
+	Stage        string    `firestore:"stage"`
+	LastError    string    `firestore:"lastError"`
+	FirstAttempt time.Time `firestore:"firstAttempt"`
+	LastAttempt  time.Time `firestore:"lastAttempt"`
+	// NextAttempt is when a file in the FileRetry state is retried.
+	NextAttempt time.Time `firestore:"nextAttempt"`
+	// Provenance describes the last successful load of the file. It is kept
+	// when a later load fails, since its data is still the data in use.
+	Provenance *Provenance `firestore:"provenance,omitempty"`
+}
+
+// Provenance records where the data loaded from a file came from and what
+// was loaded, so that the schedules in use can be traced back to a PDF.
+type Provenance struct {
+	SourceURL string `firestore:"sourceUrl" json:"sourceUrl"`
+	// PDFHash and PDFSize are the SHA-256 hash, in hex, and size in bytes of
+	// the PDF the file was converted from, if known.
+	PDFHash string `firestore:"pdfHash" json:"pdfHash"`
+	PDFSize int64  `firestore:"pdfSize" json:"pdfSize"`
+	// ContentHash and Size are the SHA-256 hash, in hex, and size in bytes
+	// of the CSV which was loaded.
+	ContentHash string `firestore:"contentHash" json:"contentHash"`
+	Size        int64  `firestore:"size" json:"size"`
+	// Trucks and Stops are the number of distinct trucks and stops parsed.
+	Trucks int `firestore:"trucks" json:"trucks"`
+	Stops  int `firestore:"stops" json:"stops"`
+	// Columns maps each field to the column of the CSV it was taken from.
+	Columns map[string]string `firestore:"columns" json:"columns"`
+	// StartDate and EndDate are the first and last days covered.
+	StartDate     string    `firestore:"startDate" json:"startDate"`
+	EndDate       string    `firestore:"endDate" json:"endDate"`
+	LoaderVersion string    `firestore:"loaderVersion" json:"loaderVersion"`
+	Loaded        time.Time `firestore:"loaded" json:"loaded"`
+}
+
+// NewProvenance returns the provenance of loading `schedule` from the CSV
+// `data`, which has the object metadata `meta`, at `now`.
+func NewProvenance(meta map[string]string, data []byte, schedule Schedule, start, end time.Time, now time.Time) *Provenance {
+	sum := sha256.Sum256(data)
+	p := &Provenance{
+		SourceURL:     meta["sourceUrl"],
+		PDFHash:       meta["sha256"],
+		ContentHash:   hex.EncodeToString(sum[:]),
+		Size:          int64(len(data)),
+		Trucks:        len(schedule.Trucks),
+		Stops:         len(schedule.Stops),
+		Columns:       schedule.Columns.Fields,
+		StartDate:     start.Format("2006-01-02"),
+		EndDate:       end.Format("2006-01-02"),
+		LoaderVersion: LoaderVersion,
+		Loaded:        now,
+	}
+	if size, err := strconv.ParseInt(meta["size"], 10, 64); err == nil {
+		p.PDFSize = size
+	}
+	return p
+}
+
+// retryDelay returns how long to wait before retrying a file which has
+// failed `attempts` times.
+func retryDelay(attempts int) time.Duration {
+	d := RetryBase
+	for i := 1; i < attempts && d < RetryMax; i++ {
+		d *= 2
+	}
+	if d > RetryMax {
+		d = RetryMax
+	}
+	return d
+}
+
+// Succeeded returns the status after a successful attempt at `now` which
+// loaded the data described by `p`.
+func (s FileStatus) Succeeded(p *Provenance, now time.Time) FileStatus {
+	if s.FirstAttempt.IsZero() {
+		s.FirstAttempt = now
+	}
+	s.OK = true
+	s.State = FileOK
+	s.Stage = ""
+	s.LastError = ""
+	s.LastAttempt = now
+	s.NextAttempt = time.Time{}
+	s.Provenance = p
+	return s
+}
+
+// Failed returns the status after an attempt which failed at `stage` at
+// `now`. The file is retried after an exponentially increasing delay, or
+// is dead-lettered once it has failed MaxAttempts times.
+func (s FileStatus) Failed(stage string, err error, now time.Time) FileStatus {
+	if s.FirstAttempt.IsZero() {
+		s.FirstAttempt = now
+	}
+	s.OK = false
+	s.Attempts++
+	s.Stage = stage
+	s.LastError = err.Error()
+	s.LastAttempt = now
+	if s.Attempts >= MaxAttempts {
+		s.State = FileDead
+		s.NextAttempt = time.Time{}
+	} else {
+		s.State = FileRetry
+		s.NextAttempt = now.Add(retryDelay(s.Attempts))
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package loaddb
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFileStatus(t *testing.T) {
+	now := time.Date(2019, time.July, 1, 12, 0, 0, 0, time.UTC)
+	var s FileStatus
+	delays := []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour, 8 * time.Hour}
+	for i, delay := range delays {
+		s = s.Failed(StageLoad, errors.New("Data in wrong format"), now)
+		if s.State != FileRetry || s.Attempts != i+1 || s.OK {
+			t.Fatalf("Failed returned %+v after %d failures", s, i+1)
+		}
+		if s.NextAttempt.Sub(now) != delay {
+			t.Fatalf("Failed set a retry delay of %s after %d failures, want %s", s.NextAttempt.Sub(now), i+1, delay)
+		}
+		now = s.NextAttempt
+	}
+	s = s.Failed(StageConvert, errors.New("No tables found"), now)
+	if s.State != FileDead || !s.NextAttempt.IsZero() || s.Stage != StageConvert || s.LastError != "No tables found" {
+		t.Fatalf("Failed did not dead-letter the file: %+v", s)
+	}
+	first := s.FirstAttempt
+
+	p := &Provenance{LoaderVersion: LoaderVersion}
+	s = s.Succeeded(p, now.Add(time.Hour))
+	if !s.OK || s.State != FileOK || s.LastError != "" || s.FirstAttempt != first || s.Provenance != p {
+		t.Fatalf("Succeeded returned %+v", s)
+	}
+	s = s.Failed(StageLoad, errors.New("Data in wrong format"), now.Add(2*time.Hour))
+	if s.Provenance != p {
+		t.Fatal("Failed dropped the provenance of the last successful load")
+	}
+	if d := retryDelay(20); d != RetryMax {
+		t.Fatalf("retryDelay(20) = %s, want %s", d, RetryMax)
+	}
+}
+
+// goDuration returns the value of a constant expression such as 5 or
+// 24 * time.Hour.
+func goDuration(expr ast.Expr) (time.Duration, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		n, err := strconv.Atoi(e.Value)
+		return time.Duration(n), err == nil
+	case *ast.SelectorExpr:
+		units := map[string]time.Duration{"Second": time.Second, "Minute": time.Minute, "Hour": time.Hour}
+		d, ok := units[e.Sel.Name]
+		return d, ok
+	case *ast.BinaryExpr:
+		x, ok1 := goDuration(e.X)
+		y, ok2 := goDuration(e.Y)
+		return x * y, ok1 && ok2 && e.Op == token.MUL
+	}
+	return 0, false
+}
+
+// TestRetryPolicyMatches checks that get_pdfs and convert_pdf, which also
+// record failures in dcGovFiles, retry and dead-letter files as load_db does.
+func TestRetryPolicyMatches(t *testing.T) {
+	want := map[string]time.Duration{"MaxAttempts": MaxAttempts, "RetryBase": RetryBase, "RetryMax": RetryMax}
+
+	file := filepath.Join("..", "..", "get_pdfs", "getpdfs", "status.go")
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, v := range want {
+		obj := f.Scope.Lookup(name)
+		if obj == nil {
+			t.Fatalf("%s has no %s", file, name)
+		}
+		got, ok := goDuration(obj.Decl.(*ast.ValueSpec).Values[0])
+		if !ok || got != v {
+			t.Errorf("%s in %s = %v, want %v", name, file, got, v)
+		}
+	}
+
+	file = filepath.Join("..", "..", "convert_pdf", "main.py")
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := regexp.MustCompile(`(?m)^MAX_ATTEMPTS = (\d+)$`).FindSubmatch(src)
+	if m == nil || string(m[1]) != strconv.Itoa(MaxAttempts) {
+		t.Errorf("MAX_ATTEMPTS in %s is not %d", file, MaxAttempts)
+	}
+	for name, v := range map[string]time.Duration{"RETRY_BASE": RetryBase, "RETRY_MAX": RetryMax} {
+		m := regexp.MustCompile(`(?m)^` + name + ` = datetime\.timedelta\(hours=(\d+)\)$`).FindSubmatch(src)
+		if m == nil || string(m[1]) != strconv.Itoa(int(v.Hours())) {
+			t.Errorf("%s in %s is not timedelta(hours=%d)", name, file, int(v.Hours()))
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package loaddb
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// stopAbbreviations maps abbreviations used in stop names to the words they
+// stand for, so that e.g. "Farragut Sq." and "Farragut Square" match. The
+// stops registry upload in backend/db/stops has a copy, which must match.
+var stopAbbreviations = map[string]string{
+	"sq":   "square",
+	"ave":  "avenue",
+	"av":   "avenue",
+	"pl":   "place",
+	"cir":  "circle",
+	"stn":  "station",
+	"sta":  "station",
+	"plz":  "plaza",
+	"blvd": "boulevard",
+}
+
+var stopWordRe = regexp.MustCompile(`[a-zA-Z0-9]+`)
+
+// StopKeyName returns a string suitable for use as a Firestore document
+// name for a stop, with abbreviations expanded so that different spellings
+// of the same stop have the same key.
+func StopKeyName(name string) string {
+	words := stopWordRe.FindAllString(strings.ToLower(name), -1)
+	for i, w := range words {
+		if full, ok := stopAbbreviations[w]; ok {
+			words[i] = full
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// GetStopIDs returns the ID of each stop, keyed by StopKeyName, creating
+// stops which do not exist.
+func GetStopIDs(ctx context.Context, stops Set, db DB) (map[string]string, error) {
+	stopIDs, err := db.StopIDs(ctx)
+	if err != nil {
+		return map[string]string{}, err
+	}
+	var newStops []string
+	for stop := range stops {
+		if _, ok := stopIDs[StopKeyName(stop)]; !ok {
+			newStops = append(newStops, stop)
+			// Reserve the key so another spelling of the same stop is
+			// not added twice.
+			stopIDs[StopKeyName(stop)] = ""
+		}
+	}
+	if len(newStops) > 0 {
+		added, err := db.AddStops(ctx, newStops)
+		if err != nil {
+			return map[string]string{}, err
+		}
+		for key, stopID := range added {
+			stopIDs[key] = stopID
+		}
+	}
+	return stopIDs, nil
+}
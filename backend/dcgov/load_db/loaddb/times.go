@@ -0,0 +1,112 @@
+package loaddb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An Assignment is a truck at a stop, optionally only during a time window,
+// e.g. a lunch or dinner session. Start and End are in the form "15:04", or
+// empty if the truck is at the stop for the whole vending day. Notes holds
+// any footnote markers or remarks from the lottery results, e.g. "*".
+type Assignment struct {
+	Truck string `firestore:"truck"`
+	Start string `firestore:"start,omitempty"`
+	End   string `firestore:"end,omitempty"`
+	Notes string `firestore:"notes,omitempty"`
+}
+
+// timeWindowRe matches a time window at the end of a stop cell, e.g.
+// "(11am-2pm)", "11:00 - 14:00" or "5 to 9 p.m.".
+var timeWindowRe = regexp.MustCompile(`(?i)[\s,]*\(?\s*(\d{1,2})(?::(\d{2}))?\s*([ap]\.?m\.?)?\s*(?:-|–|to)\s*(\d{1,2})(?::(\d{2}))?\s*([ap]\.?m\.?)?\s*\)?\s*$`)
+
+// hour24 returns the hour on a 24 hour clock for an hour on a 12 hour clock
+// with the given meridiem, "a" or "p".
+func hour24(hour int, meridiem string) int {
+	if meridiem == "p" && hour < 12 {
+		return hour + 12
+	}
+	if meridiem == "a" && hour == 12 {
+		return 0
+	}
+	return hour
+}
+
+// ParseTimeWindow splits a stop cell into the stop name and the time window
+// at its end, if any, returned as "15:04" strings. At least one of the
+// times must have am or pm or minutes, so that numbers ending a stop's
+// name, e.g. "Route 1 - 7", are not taken for times. A time without am or
+// pm takes the meridiem of the other time where that gives a window which
+// ends after it starts; otherwise hours before 8 are taken to be pm, since
+// trucks do not vend overnight.
+func ParseTimeWindow(cell string) (stop string, start string, end string) {
+	m := timeWindowRe.FindStringSubmatchIndex(cell)
+	if m == nil {
+		return cell, "", ""
+	}
+	group := func(i int) string {
+		if m[2*i] < 0 {
+			return ""
+		}
+		return cell[m[2*i]:m[2*i+1]]
+	}
+	startHour, _ := strconv.Atoi(group(1))
+	endHour, _ := strconv.Atoi(group(4))
+	startMin, endMin := group(2), group(5)
+	startMer := strings.ToLower(strings.Trim(group(3), "."))
+	endMer := strings.ToLower(strings.Trim(group(6), "."))
+	if startMer != "" {
+		startMer = startMer[0:1]
+	}
+	if endMer != "" {
+		endMer = endMer[0:1]
+	}
+	if startHour > 23 || endHour > 23 || startMin > "59" || endMin > "59" {
+		return cell, "", ""
+	}
+	if startMer == "" && endMer == "" && startMin == "" && endMin == "" {
+		return cell, "", ""
+	}
+
+	var s, e int
+	switch {
+	case startMer != "" && endMer != "":
+		s, e = hour24(startHour, startMer), hour24(endHour, endMer)
+	case startMer == "" && endMer != "":
+		e = hour24(endHour, endMer)
+		s = hour24(startHour, endMer)
+		if s > e {
+			s = hour24(startHour, "a")
+		}
+	case startMer != "" && endMer == "":
+		s = hour24(startHour, startMer)
+		e = hour24(endHour, startMer)
+		if e < s {
+			e = hour24(endHour, "p")
+		}
+	default:
+		s, e = startHour, endHour
+		if s < 8 {
+			s += 12
+		}
+		if e < s && e < 12 {
+			e += 12
+		}
+	}
+	if e < s {
+		return cell, "", ""
+	}
+	if startMin == "" {
+		startMin = "00"
+	}
+	if endMin == "" {
+		endMin = "00"
+	}
+	stop = strings.TrimSpace(cell[:m[0]])
+	if stop == "" {
+		return cell, "", ""
+	}
+	return stop, fmt.Sprintf("%02d:%s", s, startMin), fmt.Sprintf("%02d:%s", e, endMin)
+}
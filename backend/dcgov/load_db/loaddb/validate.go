@@ -0,0 +1,250 @@
+package loaddb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"foodtrucks/dcgov/blob"
+)
+
+// ValidationFile is the name of the object in the bucket which configures
+// the checks made by Validate, as a JSON ValidationConfig, e.g.
+// {"stopCapacity": {"Farragut Square": 10}}.
+const ValidationFile = "validation.json"
+
+// The rules checked by Validate.
+const (
+	// RuleDuplicateRows checks that each truck has only one row.
+	RuleDuplicateRows = "duplicateRows"
+	// RuleConflicts checks that a truck is not at two stops at once.
+	RuleConflicts = "conflictingAssignments"
+	// RuleCapacity checks that no stop has more trucks than its capacity.
+	RuleCapacity = "stopCapacity"
+)
+
+// The severities of a rule. A rule which is an error stops the file from
+// being loaded; one which is off is not checked.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityOff     = "off"
+)
+
+// ValidationConfig configures the checks made by Validate.
+type ValidationConfig struct {
+	// Rules maps rule names to their severity, overriding the defaults.
+	Rules map[string]string `json:"rules"`
+	// StopCapacity maps stop names, matched as by StopKeyName or through
+	// the stops registry, to the number of trucks permitted there. Other
+	// stops are not checked.
+	StopCapacity map[string]int `json:"stopCapacity"`
+	// CapacityTolerance is how many trucks a stop may have over its
+	// capacity with only a warning, e.g. because of a late change which
+	// the city allowed.
+	CapacityTolerance int `json:"capacityTolerance"`
+}
+
+// defaultSeverities are the severities of the rules unless configured.
+// Duplicate rows are a warning because they are usually the same row
+// extracted twice, which does no harm.
+var defaultSeverities = map[string]string{
+	RuleDuplicateRows: SeverityWarning,
+	RuleConflicts:     SeverityError,
+	RuleCapacity:      SeverityError,
+}
+
+// severity returns the severity of a rule.
+func (c ValidationConfig) severity(rule string) string {
+	if s, ok := c.Rules[rule]; ok {
+		return s
+	}
+	return defaultSeverities[rule]
+}
+
+// GetValidationConfig returns the configuration in ValidationFile in
+// `bucket`, or the defaults if there is no such file.
+func GetValidationConfig(bucket blob.Store) (ValidationConfig, error) {
+	var config ValidationConfig
+	if err := readJSONConfig(bucket, ValidationFile, &config); err != nil {
+		return ValidationConfig{}, err
+	}
+	for rule, severity := range config.Rules {
+		if _, ok := defaultSeverities[rule]; !ok {
+			return ValidationConfig{}, fmt.Errorf("Unknown rule %q in %s", rule, ValidationFile)
+		}
+		if severity != SeverityError && severity != SeverityWarning && severity != SeverityOff {
+			return ValidationConfig{}, fmt.Errorf("Unknown severity %q for %s in %s", severity, rule, ValidationFile)
+		}
+	}
+	return config, nil
+}
+
+// add adds a problem to the report as an error or warning, or not at all,
+// depending on `severity`.
+func (r *ValidationReport) add(severity string, row, column int, format string, args ...interface{}) {
+	switch severity {
+	case SeverityError:
+		r.errorf(row, column, format, args...)
+	case SeverityWarning:
+		r.warnf(row, column, format, args...)
+	}
+}
+
+// overlaps returns whether two stops of a truck on the same day overlap in
+// time. A stop with no time window lasts the whole day.
+func overlaps(a, b CellStop) bool {
+	if a.Start == "" || b.Start == "" {
+		return true
+	}
+	return a.Start < b.End && b.Start < a.End
+}
+
+// stopKey returns the key which identifies a stop in Validate: its ID in
+// `stopIDs`, the registry of stop names and aliases keyed by StopKeyName,
+// if it is there, or else its StopKeyName. So different spellings of a
+// stop listed in the registry are the same stop.
+func stopKey(name string, stopIDs map[string]string) string {
+	key := StopKeyName(name)
+	if id, ok := stopIDs[key]; ok {
+		// StopKeyName has no punctuation, so this cannot be another key.
+		return "id:" + id
+	}
+	return key
+}
+
+// conflict returns a stop in row `a` and a different stop in row `b` which
+// overlap in time, if any.
+func conflict(a, b StopCell, stopIDs map[string]string) (CellStop, CellStop, bool) {
+	for _, sa := range a.Stops {
+		for _, sb := range b.Stops {
+			if stopKey(sa.Name, stopIDs) != stopKey(sb.Name, stopIDs) && overlaps(sa, sb) {
+				return sa, sb, true
+			}
+		}
+	}
+	return CellStop{}, CellStop{}, false
+}
+
+// validateRows checks that each truck has one row, and if it has more, that
+// they do not put it at two stops at once.
+func validateRows(schedule Schedule, config ValidationConfig, stopIDs map[string]string, report *ValidationReport) {
+	byTruck := make(map[string][]ScheduleRow)
+	var keys []string
+	for _, row := range schedule.Rows {
+		key := KeyName(row.Truck)
+		if _, ok := byTruck[key]; !ok {
+			keys = append(keys, key)
+		}
+		byTruck[key] = append(byTruck[key], row)
+	}
+	for _, key := range keys {
+		rows := byTruck[key]
+		for i, b := range rows[1:] {
+			report.add(config.severity(RuleDuplicateRows), b.Row, 0,
+				"%s is also in row %d", b.Truck, rows[0].Row)
+			for _, a := range rows[:i+1] {
+				for d := time.Sunday; d <= time.Saturday; d++ {
+					sa, sb, ok := conflict(a.Cells[d], b.Cells[d], stopIDs)
+					if !ok {
+						continue
+					}
+					report.add(config.severity(RuleConflicts), b.Row, 0,
+						"%s is at %q on %ss in row %d but at %q here", b.Truck, sa.Name, d, a.Row, sb.Name)
+				}
+			}
+		}
+	}
+}
+
+// validateCapacity checks that no stop has more trucks on a day than its
+// configured capacity, counting the trucks at all spellings of the stop.
+func validateCapacity(schedule Schedule, config ValidationConfig, stopIDs map[string]string, report *ValidationReport) {
+	capacity := make(map[string]int)
+	for stop, n := range config.StopCapacity {
+		capacity[stopKey(stop, stopIDs)] = n
+	}
+	type over struct {
+		stop  string
+		most  int
+		dates []string
+	}
+	// Stops over capacity, keyed by severity and then stop key.
+	found := map[string]map[string]*over{}
+	var dates []string
+	for date := range schedule.Days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		// The trucks at each stop with a capacity, and the first of its
+		// names used that day, keyed by stop key.
+		trucks := make(map[string]Set)
+		names := make(map[string]string)
+		for stop, assignments := range schedule.Days[date] {
+			key := stopKey(stop, stopIDs)
+			if _, ok := capacity[key]; !ok {
+				continue
+			}
+			if trucks[key] == nil {
+				trucks[key] = Set{}
+			}
+			if name, ok := names[key]; !ok || stop < name {
+				names[key] = stop
+			}
+			for _, a := range assignments {
+				trucks[key][KeyName(a.Truck)] = true
+			}
+		}
+		for key, set := range trucks {
+			limit := capacity[key]
+			if len(set) <= limit {
+				continue
+			}
+			severity := config.severity(RuleCapacity)
+			if len(set)-limit <= config.CapacityTolerance {
+				severity = SeverityWarning
+			}
+			if found[severity] == nil {
+				found[severity] = make(map[string]*over)
+			}
+			o, ok := found[severity][key]
+			if !ok {
+				o = &over{stop: names[key]}
+				found[severity][key] = o
+			}
+			if len(set) > o.most {
+				o.most = len(set)
+			}
+			o.dates = append(o.dates, date)
+		}
+	}
+	for _, severity := range []string{SeverityError, SeverityWarning} {
+		var keys []string
+		for key := range found[severity] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			o := found[severity][key]
+			report.add(severity, 0, 0, "%s has up to %d trucks, capacity %d, on %s",
+				o.stop, o.most, capacity[key], strings.Join(o.dates, ", "))
+		}
+	}
+}
+
+// Validate checks that a schedule makes sense before it is uploaded: that
+// each truck has one row, that no truck is at two stops at once, and that no
+// stop has more trucks than its capacity. Stops are identified as by
+// stopKey, so the names and aliases in `stopIDs`, as returned by
+// DB.StopIDs, are the same stop. Each problem is an error or a warning
+// depending on the severity of its rule in `config`.
+func Validate(schedule Schedule, config ValidationConfig, stopIDs map[string]string) ValidationReport {
+	var report ValidationReport
+	validateRows(schedule, config, stopIDs, &report)
+	if config.severity(RuleCapacity) != SeverityOff {
+		validateCapacity(schedule, config, stopIDs, &report)
+	}
+	return report
+}
@@ -0,0 +1,164 @@
+package loaddb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	data := Records{
+		{"Business Name": "Foo", "Monday": "A", "Tuesday": "B (11am-2pm)", "Wednesday": "C", "Thursday": "OFF", "Friday": "A"},
+		{"Business Name": "Bar", "Monday": "A", "Tuesday": "OFF", "Wednesday": "C", "Thursday": "OFF", "Friday": "A"},
+		{"Business Name": "FOO", "Monday": "A", "Tuesday": "C (5-9pm)", "Wednesday": "D", "Thursday": "OFF", "Friday": "A"},
+		{"Business Name": "Baz", "Monday": "A", "Tuesday": "OFF", "Wednesday": "OFF", "Thursday": "OFF", "Friday": "OFF"},
+	}
+	// July 1, 2019 was a Monday.
+	start := time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, time.July, 5, 0, 0, 0, 0, time.UTC)
+	schedule, err := Process(data, nil, start, end, nil)
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		config   ValidationConfig
+		errors   []Problem
+		warnings []Problem
+	}{
+		{
+			name:     "defaults",
+			errors:   []Problem{{Row: 4, Message: `FOO is at "C" on Wednesdays in row 2 but at "D" here`}},
+			warnings: []Problem{{Row: 4, Message: "FOO is also in row 2"}},
+		},
+		{
+			name: "capacity",
+			config: ValidationConfig{
+				Rules:             map[string]string{RuleDuplicateRows: SeverityOff, RuleConflicts: SeverityWarning},
+				StopCapacity:      map[string]int{"a": 1, "C": 1},
+				CapacityTolerance: 1,
+			},
+			errors: []Problem{{Message: "A has up to 3 trucks, capacity 1, on 2019-07-01"}},
+			warnings: []Problem{
+				{Row: 4, Message: `FOO is at "C" on Wednesdays in row 2 but at "D" here`},
+				{Message: "A has up to 2 trucks, capacity 1, on 2019-07-05"},
+				{Message: "C has up to 2 trucks, capacity 1, on 2019-07-03"},
+			},
+		},
+	}
+	for _, test := range tests {
+		report := Validate(schedule, test.config, nil)
+		if fmt.Sprint(report.Errors) != fmt.Sprint(test.errors) {
+			t.Errorf("%s: Validate returned errors %v, want %v", test.name, report.Errors, test.errors)
+		}
+		if fmt.Sprint(report.Warnings) != fmt.Sprint(test.warnings) {
+			t.Errorf("%s: Validate returned warnings %v, want %v", test.name, report.Warnings, test.warnings)
+		}
+	}
+}
+
+func TestValidateStopAliases(t *testing.T) {
+	off := func(rec map[string]string) map[string]string {
+		for d := time.Tuesday; d <= time.Friday; d++ {
+			rec[d.String()] = "OFF"
+		}
+		return rec
+	}
+	data := Records{
+		off(map[string]string{"Business Name": "Foo", "Monday": "Farragut Sq"}),
+		off(map[string]string{"Business Name": "Foo", "Monday": "Farragut Square North"}),
+		off(map[string]string{"Business Name": "Bar", "Monday": "Farragut Square North"}),
+		off(map[string]string{"Business Name": "Baz", "Monday": "Farragut Sq"}),
+	}
+	// July 1, 2019 was a Monday.
+	day := time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC)
+	schedule, err := Process(data, nil, day, day, nil)
+	if err != nil {
+		t.Fatalf("Process returned error: %v", err)
+	}
+	config := ValidationConfig{StopCapacity: map[string]int{"Farragut Square": 2}}
+	registry := map[string]string{"farragutsquare": "s1", "farragutsquarenorth": "s1"}
+
+	tests := []struct {
+		name     string
+		stopIDs  map[string]string
+		errors   []Problem
+		warnings []Problem
+	}{
+		{
+			name:     "no registry",
+			errors:   []Problem{{Row: 3, Message: `Foo is at "Farragut Sq" on Mondays in row 2 but at "Farragut Square North" here`}},
+			warnings: []Problem{{Row: 3, Message: "Foo is also in row 2"}},
+		},
+		{
+			// Both names are one stop, so Foo is not at two stops, but the
+			// stop has three trucks.
+			name:     "registry",
+			stopIDs:  registry,
+			errors:   []Problem{{Message: "Farragut Sq has up to 3 trucks, capacity 2, on 2019-07-01"}},
+			warnings: []Problem{{Row: 3, Message: "Foo is also in row 2"}},
+		},
+	}
+	for _, test := range tests {
+		report := Validate(schedule, config, test.stopIDs)
+		if fmt.Sprint(report.Errors) != fmt.Sprint(test.errors) {
+			t.Errorf("%s: Validate returned errors %v, want %v", test.name, report.Errors, test.errors)
+		}
+		if fmt.Sprint(report.Warnings) != fmt.Sprint(test.warnings) {
+			t.Errorf("%s: Validate returned warnings %v, want %v", test.name, report.Warnings, test.warnings)
+		}
+	}
+}
+
+func TestGetValidationConfig(t *testing.T) {
+	bucket, cleanup := newTestBucket(t)
+	defer cleanup()
+
+	config, err := GetValidationConfig(bucket)
+	if err != nil || config.severity(RuleConflicts) != SeverityError {
+		t.Fatalf("GetValidationConfig returned %+v, %v without a file", config, err)
+	}
+
+	putTestFile(t, bucket, ValidationFile, `{"rules": {"duplicateRows": "error"}, "stopCapacity": {"Farragut Square": 10}}`)
+	config, err = GetValidationConfig(bucket)
+	if err != nil {
+		t.Fatalf("GetValidationConfig returned error: %v", err)
+	}
+	if config.severity(RuleDuplicateRows) != SeverityError || config.StopCapacity["Farragut Square"] != 10 {
+		t.Fatalf("GetValidationConfig returned wrong config: %+v", config)
+	}
+
+	for _, data := range []string{`{"rules": {"unknown": "error"}}`, `{"rules": {"duplicateRows": "fatal"}}`} {
+		putTestFile(t, bucket, ValidationFile, data)
+		if _, err := GetValidationConfig(bucket); err == nil {
+			t.Fatalf("GetValidationConfig failed to return an error for %s", data)
+		}
+	}
+}
+
+func TestLoadDBValidation(t *testing.T) {
+	bucket, cleanup := newTestBucket(t)
+	defer cleanup()
+	putTestFile(t, bucket, "Jul 2019 - MRV Lottery Results.csv",
+		"Business Name,Monday,Tuesday,Wednesday,Thursday,Friday\n"+
+			"Foo Truck,Stop A,Stop B,OFF,Stop A,Stop B\n"+
+			"Foo Truck,Stop B,Stop B,OFF,Stop A,Stop B\n")
+
+	db := NewMemoryDB()
+	err := LoadDB("Jul 2019 - MRV Lottery Results.csv", bucket, db)
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("LoadDB returned %v, want a validation error", err)
+	}
+	if len(db.Schedules) != 0 || len(db.Trucks) != 0 {
+		t.Fatal("LoadDB uploaded data which failed validation")
+	}
+
+	putTestFile(t, bucket, ValidationFile, `{"rules": {"conflictingAssignments": "warning"}}`)
+	if err := LoadDB("Jul 2019 - MRV Lottery Results.csv", bucket, db); err != nil {
+		t.Fatalf("LoadDB returned error: %v", err)
+	}
+	if len(db.Schedules) != 31 {
+		t.Fatalf("LoadDB set %d days, want 31", len(db.Schedules))
+	}
+}
@@ -57,13 +57,38 @@ function getTrucks() {
     })
 }
 
+// getStopInfo returns a promise with data on each stop (e.g. display name
+// and location), keyed by stop ID.
+function getStopInfo() {
+    return firebase.firestore()
+    .collection("stops")
+    .get()
+    .then(query => {
+        var stops = {};
+        query.forEach(doc => {
+            stops[doc.id] = doc.data();
+        });
+        return stops;
+    })
+}
+
 // getData returns all stops for a given day, with data about each truck
 // (e.g. average rating) merged onto it.
 function getData(date) {
     var s = getStops(date);
     var t = getTrucks();
-    return Promise.all([s, t]).then(([stops, trucks]) => {
+    var info = getStopInfo();
+    return Promise.all([s, t, info]).then(([stops, trucks, stopInfo]) => {
         for (var [i, stop] of stops.entries()) {
+            // Schedules are keyed by stop ID; older schedules use the name.
+            if (stopInfo[stop.name]) {
+                stop.id = stop.name;
+                stop.name = stopInfo[stop.id].displayName;
+                stop.abbrev = shortName(stop.name);
+                stop.link = linkName(stop.name);
+                stop.latitude = stopInfo[stop.id].latitude;
+                stop.longitude = stopInfo[stop.id].longitude;
+            }
             stop.trucks = Object.keys(stop.trucks).map(id => {
                 var data = {
                     id: id,